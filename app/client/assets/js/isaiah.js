@@ -67,6 +67,36 @@
       });
   };
 
+  /**
+   * Describe an agent along with its health, as shown in the agent picker
+   * @param {string} name
+   * @returns {string}
+   */
+  const agentLabel = (name) => {
+    const status = state.communication.agentsStatus[name];
+    if (!status) return name;
+    if (status.Status === 'unresponsive')
+      return `${name} (unresponsive, last seen ${new Date(
+        status.LastSeen
+      ).toLocaleTimeString()})`;
+    return `${name} (${status.LatencyMs} ms)`;
+  };
+
+  /**
+   * Format an amount of bytes in a human-readable way
+   * @param {number} bytes
+   * @returns {string}
+   */
+  const formatSize = (bytes) => {
+    const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+    let index = 0;
+    while (bytes >= 1024 && index < units.length - 1) {
+      bytes /= 1024;
+      index++;
+    }
+    return `${bytes.toFixed(index > 1 ? 1 : 0)} ${units[index]}`;
+  };
+
   /**
    * Determine whether a key-value association exists in the localStorage
    * @param {string} key
@@ -560,7 +590,8 @@
 
     // prettier-ignore
     const body = prompt.input.isEnabled
-      ? `<div class="cell">${prompt.input.name}${prompt.input.type === 'input' ? ':' : ''}</div>
+      ? `${prompt.text ? `<p class="request">${prompt.text}</p>` : ''}
+         <div class="cell">${prompt.input.name}${prompt.input.type === 'input' ? ':' : ''}</div>
          ${
            prompt.input.type === 'input'
              ? `<input
@@ -797,6 +828,26 @@
                <span class="cell">O        </span>
                <span class="cell">show overview</span>
              </div>
+             <div class="row is-not-interactive">
+               <span class="cell">L        </span>
+               <span class="cell">show audit log</span>
+             </div>
+             <div class="row is-not-interactive">
+               <span class="cell">F        </span>
+               <span class="cell">enroll two-factor authentication</span>
+             </div>
+             <div class="row is-not-interactive">
+               <span class="cell">K        </span>
+               <span class="cell">manage API tokens</span>
+             </div>
+             <div class="row is-not-interactive">
+               <span class="cell">M        </span>
+               <span class="cell">manage Docker hosts</span>
+             </div>
+             <div class="row is-not-interactive">
+               <span class="cell">I        </span>
+               <span class="cell">reveal/hide secrets in inspector</span>
+             </div>
              <div class="row is-not-interactive">
                <span class="cell">J        </span>
                <span class="cell">jump to any resource</span>
@@ -917,7 +968,7 @@
                  <div class="row-summary">
                    <p>
                      ${i.Server.Role === 'Agent' ? ' <i>Agent</i>' : ''}
-                     ${i.Server.Name} (Docker ${i.Docker.Version})
+                     ${i.Server.Name}${i.Error ? '' : ` (Docker ${i.Docker.Version})`}
                      <em>
                        ${
                          (i.Docker.Host.includes('://')
@@ -928,6 +979,14 @@
                      </em>
                    </p>
                  </div>
+                 ${
+                   i.Error
+                     ? `
+                 <div class="row-information for-error">
+                   <span>${s(i.Error)}</span>
+                 </div>
+                   `
+                     : `
                  <div class="row-information">
                    <div class="row-information-box for-containers">
                      <svg xmlns="http://www.w3.org/2000/svg" fill="none" viewBox="0 0 24 24" stroke-width="1.5" stroke="currentColor"> <path stroke-linecap="round" stroke-linejoin="round" d="m21 7.5-9-5.25L3 7.5m18 0-9 5.25m9-5.25v9l-9 5.25M3 7.5l9 5.25M3 7.5v9l9 5.25m0-9v9" /> </svg>
@@ -947,9 +1006,7 @@
                    </div>
 
                    ${
-                     i.Server.Host.startsWith('unix://') ||
-                     (i.Server.Host === '' &&
-                       i.Docker.Host.startsWith('unix://'))
+                     i.Server.CountCPU > 0
                        ? `
                          <div class="row-information-specs">
                            <div class="row-information-box">
@@ -970,6 +1027,22 @@
                        : '<span class="row-filler">Remote host</span>'
                    }
                  </div>
+                 <div class="row-details">
+                   <span>${s(i.Docker.OperatingSystem || '')}</span>
+                   <span>Kernel ${s(i.Docker.KernelVersion || '')}</span>
+                   <span>${s(i.Docker.StorageDriver || '')}</span>
+                   <span>
+                     ${i.Resources.Containers.Running || 0} running,
+                     ${i.Resources.Containers.Stopped || 0} stopped
+                   </span>
+                   ${
+                     i.Resources.DiskUsage
+                       ? `<span>${formatSize(i.Resources.DiskUsage.Total)} on disk</span>`
+                       : ''
+                   }
+                 </div>
+                   `
+                 }
                </div>
              </div>
           `
@@ -1343,10 +1416,22 @@
         _state.communication.availableAgents.length > 0
           ? `<button data-action="agent">${
               _state.communication.currentAgent || 'Master'
+            }${
+              (
+                _state.communication.agentsStatus[
+                  _state.communication.currentAgent
+                ] || {}
+              ).Status === 'unresponsive'
+                ? ' - unresponsive'
+                : ''
             }</button>`
           : 'Master';
       if (_state.communication.currentHost)
-        fullIndicator = `${fullIndicator} (<button data-action="host">${_state.communication.currentHost}</button>)`;
+        fullIndicator = `${fullIndicator} (<button data-action="host">${_state.communication.currentHost}${
+          _state.communication.offlineHosts.includes(_state.communication.currentHost)
+            ? ' - offline'
+            : ''
+        }</button>)`;
 
       hgetConnectionIndicator('communication-target').innerHTML = fullIndicator;
     }
@@ -1684,6 +1769,7 @@
       content: [],
       horizontalScroll: 0,
       verticalScroll: 0,
+      isRevealed: false,
     },
 
     /**
@@ -1734,6 +1820,16 @@
        */
       masterPassword: null,
 
+      /**
+       * @type {string}
+       */
+      masterUsername: null,
+
+      /**
+       * @type {string|null}
+       */
+      singleSignOnURL: null,
+
       /**
        * @type {string}
        */
@@ -1758,6 +1854,16 @@
        * @type {Array<string>}
        */
       availableHosts: [],
+
+      /**
+       * @type {Array<string>}
+       */
+      offlineHosts: [],
+
+      /**
+       * @type {Object<string, {Status: string, LastSeen: string, LatencyMs: number}>}
+       */
+      agentsStatus: {},
     },
 
     /**
@@ -1838,15 +1944,23 @@
      * @property {object} Docker
      * @property {string} Docker.Version
      * @property {string} Docker.Host
+     * @property {string} Docker.OperatingSystem
+     * @property {string} Docker.KernelVersion
+     * @property {string} Docker.StorageDriver
+     * @property {string} [Error]
      * @property {object} Resources
      * @property {object} Resources.Containers
      * @property {number} Resources.Containers.Count
+     * @property {number} Resources.Containers.Running
+     * @property {number} Resources.Containers.Stopped
      * @property {object} Resources.Images
      * @property {number} Resources.Images.Count
      * @property {object} Resources.Volumes
      * @property {number} Resources.Volumes.Count
      * @property {object} Resources.Networks
      * @property {number} Resources.Networks.Count
+     * @property {object} [Resources.DiskUsage]
+     * @property {number} Resources.DiskUsage.Total
      * @property {object} Server
      * @property {string} Server.Host
      * @property {string} Server.Name
@@ -2039,6 +2153,7 @@
     _exit: function () {
       state.isAuthenticated = false;
       websocketSend({ action: 'auth.logout' });
+      localStorage.removeItem('authenticationToken');
 
       setTimeout(() => {
         cmdRun(cmds._showAuthentication);
@@ -2355,6 +2470,7 @@
      * Private - Get available inspector (sub) tabs for the current tab (containers, images, etc.)
      */
     _inspectorTabs: function () {
+      state.inspector.isRevealed = false;
       const currentTabKey = sgetCurrentTabKey();
       websocketSend({ action: `${currentTabKey.slice(0, -1)}.inspect.tabs` });
     },
@@ -2375,11 +2491,20 @@
       if (currentInspectorTab === 'Logs')
         payload['showTimestamps'] = state.settings.enableTimestampDisplay;
 
+      // When the user asked to reveal the redacted values, use the dedicated action
+      // Such as : container.inspect.env.reveal
+      let suffix = '';
+      if (
+        state.inspector.isRevealed &&
+        ['Env', 'Config'].includes(currentInspectorTab)
+      )
+        suffix = '.reveal';
+
       // Produces something like : <tab>.inspect.<sub-tab>
       // Such as : container.inspect.logs
       websocketSend({
         // prettier-ignore
-        action: `${currentTabKey.slice(0,-1)}.inspect.${currentInspectorTab.toLowerCase()}`,
+        action: `${currentTabKey.slice(0,-1)}.inspect.${currentInspectorTab.toLowerCase()}${suffix}`,
         args: payload,
       });
     },
@@ -2389,6 +2514,9 @@
      */
     _showAuthentication: function () {
       cmdRun(cmds._showPrompt, {
+        text: state.communication.singleSignOnURL
+          ? `<a href="${state.communication.singleSignOnURL}">Log in with Single Sign-On</a>`
+          : undefined,
         input: {
           isEnabled: true,
           name: 'Password',
@@ -2410,7 +2538,69 @@
 
       state.communication.masterPassword = password;
 
-      websocketSend({ action: 'auth.login', args: { Password: password } });
+      const args = { Password: password };
+      if (state.communication.masterUsername)
+        args.Username = state.communication.masterUsername;
+
+      websocketSend({ action: 'auth.login', args });
+    },
+
+    /**
+     * Private - Resume a previous session using the token stored in LocalStorage
+     */
+    _resumeAuthentication: function () {
+      websocketSend({
+        action: 'auth.resume',
+        args: { Token: localStorage.getItem('authenticationToken') },
+      });
+    },
+
+    /**
+     * Private - Show the prompt for an additional authentication step requested by the server
+     * @param {string} step
+     */
+    _showAuthenticationStep: function (step) {
+      cmdRun(cmds._showPrompt, {
+        input: {
+          isEnabled: true,
+          name: step,
+          placeholder: `Please fill in your ${step.toLowerCase()}`,
+          type: 'input',
+        },
+        callback: cmds._authenticateStep,
+      });
+    },
+
+    /**
+     * Private - Send the value of an additional authentication step to the server
+     * @param {object} input
+     */
+    _authenticateStep: function (input) {
+      const [step, value] = Object.entries(input)[0];
+
+      if (!value) return;
+
+      if (step === 'Username') state.communication.masterUsername = value;
+
+      const args = { Password: state.communication.masterPassword };
+      if (state.communication.masterUsername)
+        args.Username = state.communication.masterUsername;
+      if (step === 'Code') args.Code = value;
+
+      websocketSend({ action: 'auth.login', args });
+    },
+
+    /**
+     * Private - Confirm the two-factor enrollment with a first code from the authenticator app
+     * @param {object} input
+     */
+    _confirmTwoFactor: function (input) {
+      if (!input.Code) return;
+
+      websocketSend(
+        { action: 'auth.totp.confirm', args: { Code: input.Code } },
+        true
+      );
     },
 
     /**
@@ -2430,18 +2620,32 @@
       cmdRun(cmds._clear);
 
       let hasAttemptedAutoLogin = false;
+      const name = action.Agent || action.Label;
 
-      if (action.Label === 'Master') state.communication.currentAgent = null;
+      if (name === 'Master') state.communication.currentAgent = null;
       else {
-        state.communication.currentAgent = action.Label;
+        state.communication.currentAgent = name;
 
         // Attempt auto-login using the known password used on Master node
-        if (!state.communication.authenticatedAgents.includes(action.Label)) {
+        if (!state.communication.authenticatedAgents.includes(name)) {
           if (state.communication.masterPassword) {
             websocketSend({
               action: 'auth.login',
               args: {
                 Password: state.communication.masterPassword,
+                Username: state.communication.masterUsername,
+                AutoLogin: true,
+              },
+            });
+
+            hasAttemptedAutoLogin = true;
+          }
+          // Attempt auto-login using the session token (when agents share the Master's signing key)
+          else if (lsExists('authenticationToken')) {
+            websocketSend({
+              action: 'auth.resume',
+              args: {
+                Token: localStorage.getItem('authenticationToken'),
                 AutoLogin: true,
               },
             });
@@ -2467,7 +2671,7 @@
      * @param {MenuAction} action
      */
     _pickHost: function (action) {
-      state.communication.currentHost = action.Label;
+      state.communication.currentHost = action.Host || action.Label;
       cmdRun(cmds._init);
     },
 
@@ -2664,6 +2868,123 @@
       });
     },
 
+    /**
+     * Private - Create a new API token based on a JSON input
+     * @param {object} args
+     * @param {string} args._ (new token's scopes, as JSON)
+     */
+    _createApiToken: function (args) {
+      const content = Object.values(args)[0];
+
+      if (!content) return;
+
+      let scopes;
+      try {
+        scopes = JSON.parse(content);
+      } catch (e) {
+        state.message.category = 'report';
+        state.message.type = 'error';
+        state.message.title = 'Error';
+        state.message.content = 'The API token definition must be valid JSON';
+        state.message.isEnabled = true;
+        state.helper = 'message';
+        cmdRun(cmds._showPopup, 'message');
+        return;
+      }
+
+      websocketSend({ action: 'auth.token.create', args: scopes }, true);
+    },
+
+    /**
+     * Private - Show the prompt for creating a new API token
+     */
+    _promptApiToken: function () {
+      cmdRun(cmds._showPrompt, {
+        input: {
+          isEnabled: true,
+          name: 'Create a new API token',
+          placeholder: 'Please fill in the token definition (JSON)',
+          type: 'textarea',
+          defaultValue: JSON.stringify(
+            {
+              Name: 'ci',
+              Role: 'operator',
+              Actions: ['stack.restart', 'stack.update'],
+              Hosts: [],
+              Agents: [],
+              Lifetime: 2592000,
+            },
+            null,
+            2
+          ),
+        },
+        callback: cmds._createApiToken,
+      });
+    },
+
+    /**
+     * Private - Revoke the API token associated with the given menu action
+     * @param {MenuAction} action
+     */
+    _revokeApiToken: function (action) {
+      websocketSend(
+        { action: 'auth.token.revoke', args: { Name: action.Name } },
+        true
+      );
+    },
+
+    /**
+     * Private - Add a new Docker host based on a "<name> <address> [key=value ...]" input
+     * @param {object} args
+     * @param {string} args._ (new host's name, address, and transport options)
+     */
+    _addHost: function (args) {
+      const content = (Object.values(args)[0] || '').trim();
+
+      if (!content) return;
+
+      const [name, address, ...options] = content.split(/\s+/);
+      websocketSend(
+        {
+          action: 'host.add',
+          args: { Name: name, Address: address || '', Options: options },
+        },
+        true
+      );
+    },
+
+    /**
+     * Private - Show the prompt for adding a new Docker host
+     */
+    _promptHost: function () {
+      cmdRun(cmds._showPrompt, {
+        input: {
+          isEnabled: true,
+          name: 'Add a new host',
+          placeholder:
+            'Please fill in the host (e.g. production tcp://10.0.0.5:2376 ca=/certs/ca.pem)',
+          type: 'input',
+        },
+        callback: cmds._addHost,
+      });
+    },
+
+    /**
+     * Private - Test the Docker host associated with the given menu action
+     * @param {MenuAction} action
+     */
+    _testHost: function (action) {
+      websocketSend({ action: 'host.test', args: { Name: action.Name } }, true);
+    },
+
+    /**
+     * Private - Remove the Docker host associated with the given menu action
+     * @param {MenuAction} action
+     */
+    _removeHost: function (action) {
+      websocketSend({ action: 'host.remove', args: { Name: action.Name } }, true);
+    },
+
     /**
      * Private - Edit an existing stack based on a new docker-compose.yml input
      * @param {object} args
@@ -3783,10 +4104,14 @@
         RunLocally: true,
         RequiresResource: false,
         RequiresMenuAction: true,
-        Label: t,
+        Label: agentLabel(t),
+        Agent: t,
         Command: '_pickAgent',
       }));
 
+      // Refresh the agents' health while the picker is shown
+      websocketSend({ action: 'agent.status' }, true);
+
       state.menu.actions.unshift({
         RunLocally: true,
         RequiresResource: false,
@@ -3812,7 +4137,10 @@
         RunLocally: true,
         RequiresResource: false,
         RequiresMenuAction: true,
-        Label: t,
+        Label: state.communication.offlineHosts.includes(t)
+          ? `${t} (offline)`
+          : t,
+        Host: t,
         Command: '_pickHost',
       }));
 
@@ -4022,6 +4350,45 @@
       hgetSearchInput().focus();
     },
 
+    /**
+     * Public - Request the most recent audit records from the server
+     */
+    auditLog: function () {
+      websocketSend({ action: 'audit.list', args: { Limit: 50 } });
+    },
+
+    /**
+     * Public - Request the list of Docker hosts, to manage them (multi-host)
+     */
+    manageHosts: function () {
+      if (state.communication.availableHosts.length === 0) return;
+      websocketSend({ action: 'host.list' }, true);
+    },
+
+    /**
+     * Public - Reveal / Hide again the redacted values in the current inspector (Env, Config)
+     */
+    revealSecrets: function () {
+      if (!state.inspector.isEnabled) return;
+
+      state.inspector.isRevealed = !state.inspector.isRevealed;
+      cmdRun(cmds._refreshInspector);
+    },
+
+    /**
+     * Public - Request the list of API tokens, to manage them
+     */
+    apiTokens: function () {
+      websocketSend({ action: 'auth.token.list' }, true);
+    },
+
+    /**
+     * Public - Start the two-factor enrollment of the current account (on Master)
+     */
+    twoFactor: function () {
+      websocketSend({ action: 'auth.totp.enroll' }, true);
+    },
+
     /**
      * Public - Request a global overview from the server
      */
@@ -4189,6 +4556,11 @@
     h: 'hub',
     G: 'github',
     O: 'overview',
+    L: 'auditLog',
+    F: 'twoFactor',
+    K: 'apiTokens',
+    M: 'manageHosts',
+    I: 'revealSecrets',
     C: 'createStack',
 
     // Misc
@@ -4638,7 +5010,9 @@
   const listenerSocketOpen = (evt) => {
     state.isConnected = true;
     state.hasEstablishedConnection = true;
-    cmdRun(cmds._showAuthentication);
+
+    if (lsExists('authenticationToken')) cmdRun(cmds._resumeAuthentication);
+    else cmdRun(cmds._showAuthentication);
   };
 
   /**
@@ -4718,6 +5092,12 @@
           state.communication.availableAgents =
             notification.Content.Agents || [];
 
+        // Keep track of the hosts that don't answer, and of the agents' health
+        state.communication.offlineHosts =
+          notification.Content.OfflineHosts || [];
+        state.communication.agentsStatus =
+          notification.Content.AgentsStatus || {};
+
         // Update hosts list only on the very first init
         if (state.communication.availableHosts.length === 0) {
           state.communication.availableHosts = notification.Content.Hosts || [];
@@ -4854,6 +5234,10 @@
           // Authentication error
           if ('error' === notification.Type) {
             state.communication.masterPassword = null;
+            state.communication.masterUsername = null;
+
+            if (notification.Content.Authentication.Expired)
+              localStorage.removeItem('authenticationToken');
 
             cmdRun(cmds._showPopup, 'message');
             setTimeout(() => {
@@ -4861,8 +5245,38 @@
               cmdRun(cmds._showAuthentication);
             }, state._delays.forAuthentication);
           }
+          // Single Sign-On offer (shown alongside the password prompt)
+          else if (
+            'info' === notification.Type &&
+            notification.Content.Authentication.SingleSignOn
+          ) {
+            cmdRun(cmds._clearMessage);
+            state.communication.singleSignOnURL =
+              notification.Content.Authentication.SingleSignOn;
+
+            if (!state.isAuthenticated && !lsExists('authenticationToken'))
+              cmdRun(cmds._showAuthentication);
+          }
+          // Authentication step (additional information required)
+          else if ('info' === notification.Type) {
+            cmdRun(cmds._clearMessage);
+            cmdRun(
+              cmds._showAuthenticationStep,
+              notification.Content.Authentication.Step
+            );
+          }
           // Authentication success
           else if ('success' === notification.Type) {
+            // Store the session token issued by Master, to resume the session later
+            if (
+              notification.Content.Authentication.Token &&
+              !state.communication.currentAgent
+            )
+              localStorage.setItem(
+                'authenticationToken',
+                notification.Content.Authentication.Token
+              );
+
             // Normal case
             if (!notification.Content.Authentication.Spontaneous) {
               if (!notification.Content.Authentication.Seamless)
@@ -4942,6 +5356,129 @@
           cmdRun(cmds._showPopup, 'menu');
         }
 
+        if ('Audit' in notification.Content) {
+          const escape = (v) =>
+            String(v || '').replace(
+              /[&<>"']/g,
+              (c) => `&#${c.charCodeAt(0)};`
+            );
+
+          state.message.category = 'report';
+          state.message.type = 'info';
+          state.message.title = 'Audit log';
+          state.message.content =
+            notification.Content.Audit.length === 0
+              ? 'No audit record was found.'
+              : notification.Content.Audit.map(
+                  (r) =>
+                    `${escape(r.Time)} - <em class="has-accent">${escape(r.User || r.Address)}</em>` +
+                    ` ${escape(r.Action)} ${escape(r.Resource)}` +
+                    `${r.Host ? ` @ ${escape(r.Host)}` : ''}${r.Agent ? ` @ ${escape(r.Agent)}` : ''}` +
+                    ` (${escape(r.Outcome)}${r.Message ? ` : ${escape(r.Message)}` : ''})`
+                ).join('<span class="line-break"></span>');
+          state.message.isEnabled = true;
+          state.helper = 'message';
+          cmdRun(cmds._showPopup, 'message');
+        }
+
+        if ('APITokens' in notification.Content) {
+          state.menu.key = 'menu';
+          state.menu.actions = [
+            {
+              Label: 'create a new token',
+              Command: '_promptApiToken',
+              RequiresResource: false,
+              RunLocally: true,
+            },
+            ...notification.Content.APITokens.map((t) => ({
+              Label: `revoke ${s(t.Name)} (${s(t.Role)}, ${
+                t.Expires
+                  ? `expires ${s(new Date(t.Expires * 1000).toLocaleString())}`
+                  : 'never expires'
+              })`,
+              Command: '_revokeApiToken',
+              Name: t.Name,
+              RequiresMenuAction: true,
+              RequiresResource: false,
+              RunLocally: true,
+            })),
+          ];
+          state.navigation.currentMenuRow = 1;
+          state.helper = 'menu';
+          state.isLoading = false;
+
+          cmdRun(cmds._showPopup, 'menu');
+        }
+
+        if ('DockerHosts' in notification.Content) {
+          state.menu.key = 'menu';
+          state.menu.actions = [
+            {
+              Label: 'add a new host',
+              Command: '_promptHost',
+              RequiresResource: false,
+              RunLocally: true,
+            },
+            ...notification.Content.DockerHosts.flatMap((h) => [
+              {
+                Label: `test ${s(h.Name)} (${s(h.Address)}${
+                  h.Offline ? ', offline' : ''
+                })`,
+                Command: '_testHost',
+                Name: h.Name,
+                RequiresMenuAction: true,
+                RequiresResource: false,
+                RunLocally: true,
+              },
+              {
+                Label: `remove ${s(h.Name)}`,
+                Command: '_removeHost',
+                Name: h.Name,
+                RequiresMenuAction: true,
+                RequiresResource: false,
+                RunLocally: true,
+              },
+            ]),
+          ];
+          state.navigation.currentMenuRow = 1;
+          state.helper = 'menu';
+          state.isLoading = false;
+
+          cmdRun(cmds._showPopup, 'menu');
+        }
+
+        if ('Hosts' in notification.Content) {
+          state.communication.availableHosts = notification.Content.Hosts || [];
+          state.communication.offlineHosts =
+            notification.Content.OfflineHosts || [];
+
+          // When the current host was removed, switch to the first one available
+          if (
+            state.communication.currentHost &&
+            !state.communication.availableHosts.includes(
+              state.communication.currentHost
+            )
+          ) {
+            cmdRun(cmds._clear);
+            state.communication.currentHost =
+              state.communication.availableHosts[0] || null;
+            cmdRun(cmds._init);
+          }
+        }
+
+        if ('APIToken' in notification.Content) {
+          state.message.category = 'report';
+          state.message.type = 'success';
+          state.message.title = 'API token created';
+          state.message.content =
+            `The token ${s(notification.Content.APIToken.Name)} was created. ` +
+            `Please copy it now, as it won't be shown again :` +
+            `<span class="line-break"></span>${s(notification.Content.APIToken.Token)}`;
+          state.message.isEnabled = true;
+          state.helper = 'message';
+          cmdRun(cmds._showPopup, 'message');
+        }
+
         if ('Address' in notification.Content) {
           window.open(notification.Content.Address, '_blank');
         }
@@ -4976,6 +5513,17 @@
           }
         }
 
+        if ('AgentsStatus' in notification.Content) {
+          state.communication.agentsStatus =
+            notification.Content.AgentsStatus || {};
+
+          // Update the agent picker in place when it's shown
+          if (state.menu.key === 'agent')
+            state.menu.actions = state.menu.actions.map((a) =>
+              a.Agent ? { ...a, Label: agentLabel(a.Agent) } : a
+            );
+        }
+
         if ('Agents' in notification.Content) {
           cmdRun(cmds._clear);
 
@@ -5124,6 +5672,7 @@
           'Input' in notification.Content
         )
           cmdRun(cmds._showPrompt, {
+            text: notification.Content.Message,
             callback: cmds[notification.Content.Command],
             input: {
               isEnabled: true,
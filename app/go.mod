@@ -13,6 +13,7 @@ require (
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/olahol/melody v1.1.4
 	github.com/shirou/gopsutil v3.21.11+incompatible
+	golang.org/x/crypto v0.47.0
 )
 
 require (
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"embed"
 	"errors"
@@ -24,7 +25,10 @@ import (
 	_client "will-moss/isaiah/server/_internal/client"
 	_fs "will-moss/isaiah/server/_internal/fs"
 	_json "will-moss/isaiah/server/_internal/json"
+	"will-moss/isaiah/server/_internal/oidc"
 	_os "will-moss/isaiah/server/_internal/os"
+	_password "will-moss/isaiah/server/_internal/password"
+	"will-moss/isaiah/server/_internal/redact"
 	_session "will-moss/isaiah/server/_internal/session"
 	_strconv "will-moss/isaiah/server/_internal/strconv"
 	"will-moss/isaiah/server/_internal/tty"
@@ -101,43 +105,79 @@ func performVerifications() error {
 
 	// 7. Ensure docker_hosts file is available when multi-host is enabled
 	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
-		if _, err := os.Stat("docker_hosts"); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(server.HostsFile); errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("Failed Verification : docker_hosts file is missing. Please put it next to the executable")
 		}
 	}
 
-	// 8. Ensure every host is reachable if multi-host is enabled, and docker_hosts is well-formatted
+	// 8. Ensure docker_hosts is well-formatted if multi-host is enabled (unreachable hosts are marked offline, not fatal)
 	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
-		raw, err := os.ReadFile("docker_hosts")
-		if err != nil {
-			return fmt.Errorf("Failed Verification : docker_hosts file can't be read -> %s", err)
+		if _, err := server.LoadHosts(server.HostsFile); err != nil {
+			return fmt.Errorf("Failed Verification : docker_hosts file can't be used -> %s", err)
 		}
-		if len(raw) == 0 {
-			return fmt.Errorf("Failed Verification : docker_hosts file is empty.")
+	}
+
+	// 9. Ensure users.json file is available and well-formatted when multi-user is enabled
+	if _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" {
+		if _, err := os.Stat("users.json"); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed Verification : users.json file is missing. Please put it next to the executable")
 		}
 
-		lines := strings.Split(string(raw), "\n")
-		for _, line := range lines {
-			if len(line) == 0 {
-				continue
-			}
+		if _, err := server.LoadUsers("users.json"); err != nil {
+			return fmt.Errorf("Failed Verification : users.json file can't be loaded -> %s", err)
+		}
+	}
 
-			parts := strings.Split(line, " ")
-			if len(parts) != 2 {
-				return fmt.Errorf("Failed Verification : docker_hosts file isn't properly formatted. Line : -> %s", line)
+	// 10. Ensure the OpenID Connect provider is reachable and properly configured when enabled
+	if _os.GetEnv("OIDC_ENABLED") == "TRUE" {
+		for _, setting := range []string{"OIDC_ISSUER", "OIDC_CLIENT_ID", "OIDC_REDIRECT_URL"} {
+			if _os.GetEnv(setting) == "" {
+				return fmt.Errorf("Failed Verification : OpenID Connect is enabled, but %s is missing", setting)
 			}
+		}
 
-			c, _err := client.NewClientWithOpts(client.WithHost(parts[1]))
-			if _err != nil {
-				return fmt.Errorf("Failed Verification : Access to Docker host -> %s", _err)
-			}
+		redirectURL, err := url.Parse(_os.GetEnv("OIDC_REDIRECT_URL"))
+		if err != nil || redirectURL.Path != "/auth/oidc/callback" {
+			return fmt.Errorf("Failed Verification : OIDC_REDIRECT_URL must point to the /auth/oidc/callback path of Isaiah")
+		}
 
-			_, _err = c.ServerVersion(context.Background())
-			if _err != nil {
-				return fmt.Errorf("Failed Verification : Retrieving version from Docker host -> %s", _err)
-			}
+		if _, err := oidc.Discover(context.Background(), _os.GetEnv("OIDC_ISSUER")); err != nil {
+			return fmt.Errorf("Failed Verification : OpenID Connect provider is unreachable -> %s", err)
+		}
+	}
 
-			c.Close()
+	// 11. Ensure the agents' CA bundle is readable when mutual TLS is enabled on Master
+	if _os.GetEnv("SERVER_ROLE") == "Master" && _os.GetEnv("AGENT_CA_FILE") != "" {
+		if _os.GetEnv("SSL_ENABLED") != "TRUE" {
+			return fmt.Errorf("Failed Verification : AGENT_CA_FILE requires SSL_ENABLED to be set")
+		}
+		if _, err := server.LoadCertPool(_os.GetEnv("AGENT_CA_FILE")); err != nil {
+			return fmt.Errorf("Failed Verification : Agents' CA bundle can't be loaded -> %s", err)
+		}
+	}
+
+	// 12. Ensure the agent's certificate, key, and Master's CA bundle are readable when provided
+	if _os.GetEnv("SERVER_ROLE") == "Agent" && _os.GetEnv("MASTER_TLS_ENABLED") == "TRUE" {
+		if _, _, err := server.MasterDialer(); err != nil {
+			return fmt.Errorf("Failed Verification : Agent's TLS settings are invalid -> %s", err)
+		}
+	}
+
+	// 13. Ensure policies.json file is available and well-formatted when authorization policies are enabled
+	if _os.GetEnv("POLICIES_ENABLED") == "TRUE" && _os.GetEnv("SERVER_ROLE") == "Master" {
+		if _, err := os.Stat("policies.json"); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Failed Verification : policies.json file is missing. Please put it next to the executable")
+		}
+
+		if _, err := server.LoadPolicies("policies.json"); err != nil {
+			return fmt.Errorf("Failed Verification : policies.json file can't be loaded -> %s", err)
+		}
+	}
+
+	// 14. Ensure the redaction rules are valid when redaction is enabled
+	if _os.GetEnv("REDACTION_ENABLED") == "TRUE" {
+		if _, err := redact.Compile(_os.GetEnv("REDACTION_NAME_PATTERNS"), _os.GetEnv("REDACTION_VALUE_PATTERNS")); err != nil {
+			return fmt.Errorf("Failed Verification : Redaction rules are invalid -> %s", err)
 		}
 	}
 
@@ -154,6 +194,31 @@ func main() {
 			fmt.Printf("Version: -VERSION-")
 			return
 		}
+
+		// Handle --hash-password switch (reads the password on stdin, optional algorithm argument)
+		if args[0] == "--hash-password" {
+			algorithm := "bcrypt"
+			if len(args) > 1 {
+				algorithm = args[1]
+			}
+
+			fmt.Fprint(os.Stderr, "Password: ")
+			input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			input = strings.TrimRight(input, "\r\n")
+			if input == "" {
+				fmt.Fprintln(os.Stderr, "Error : The password can't be empty")
+				os.Exit(1)
+			}
+
+			hashed, err := _password.Hash(input, algorithm)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Println(hashed)
+			return
+		}
 	}
 
 	// Load default settings via default.env file (workaround since the file is embed)
@@ -195,6 +260,17 @@ func main() {
 		}
 	}
 
+	// Ensure every command, and every route of the REST API, declares its schemas
+	// (Never skipped, as these are defined by the program itself rather than its environment)
+	if err := server.VerifyCommands(); err != nil {
+		log.Printf("Commands are incomplete, abort -> %s", err)
+		return
+	}
+	if err := server.VerifyAPIRoutes(); err != nil {
+		log.Printf("REST API routes are incomplete, abort -> %s", err)
+		return
+	}
+
 	// Set up everything (Melody instance, Docker client, Server settings)
 	var _server server.Server
 	if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" {
@@ -207,33 +283,64 @@ func main() {
 			Melody: melody.New(),
 		}
 
-		// Populate server's known hosts when multi-host is enabled
-		_server.Hosts = make(server.HostsArray, 0)
-		var firstHost string
+		// Populate server's known hosts when multi-host is enabled, and reload them whenever docker_hosts changes
+		hosts, _ := server.LoadHosts(server.HostsFile)
+		_server.ReloadHosts(hosts)
+		go _server.WatchHosts(server.HostsFile)
+	}
 
-		raw, _ := os.ReadFile("docker_hosts")
-		lines := strings.Split(string(raw), "\n")
-		for _, line := range lines {
-			if len(line) == 0 {
-				continue
-			}
-			parts := strings.Split(line, " ")
+	// Populate server's known users when multi-user is enabled
+	if _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" {
+		users, err := server.LoadUsers("users.json")
+		if err != nil {
+			log.Print("Error loading users.json file, abort")
+			log.Print(err)
+			return
+		}
+		_server.Users = users
+	}
 
-			_server.Hosts = append(_server.Hosts, []string{parts[0], parts[1]})
+	// Populate server's authorization policies when enabled
+	if _os.GetEnv("POLICIES_ENABLED") == "TRUE" && _os.GetEnv("SERVER_ROLE") == "Master" {
+		policies, err := server.LoadPolicies("policies.json")
+		if err != nil {
+			log.Print("Error loading policies.json file, abort")
+			log.Print(err)
+			return
+		}
+		_server.Policies = policies
+	}
 
-			if len(firstHost) == 0 {
-				firstHost = parts[0]
+	// Warn about the usage of unsalted sha256 hashes, kept only for backward compatibility
+	if _os.GetEnv("AUTHENTICATION_ENABLED") == "TRUE" {
+		if _password.IsLegacy(_os.GetEnv("AUTHENTICATION_HASH")) {
+			log.Print("Deprecation warning : AUTHENTICATION_HASH uses an unsalted sha256 hash. Please generate a new one using --hash-password")
+		}
+		for _, u := range _server.Users {
+			if _password.IsLegacy(u.Hash) {
+				log.Printf("Deprecation warning : The account %s uses an unsalted sha256 hash. Please generate a new one using --hash-password", u.Name)
 			}
 		}
 
-		// Set default Docker client on the first known host
-		_server.SetHost(firstHost)
+		// Warn about the session tokens signed with a random key, as they won't survive a restart
+		if _os.GetEnv("AUTHENTICATION_TOKEN_KEY") == "" {
+			log.Print("Warning : No AUTHENTICATION_TOKEN_KEY was provided, a random one will be used, and every session will be invalidated on restart")
+		} else if len(_os.GetEnv("AUTHENTICATION_TOKEN_KEY")) < 32 {
+			log.Print("Warning : AUTHENTICATION_TOKEN_KEY is shorter than 32 characters, and may be guessed. Please use a longer, random one")
+		}
 	}
+
 	_server.Melody.Config.MaxMessageSize = _strconv.ParseInt(_os.GetEnv("SERVER_MAX_READ_SIZE"), 10, 64)
 
+	// Refuse cross-origin websocket connections, unless explicitly allowed
+	_server.Melody.Upgrader.CheckOrigin = server.IsOriginAllowed
+
 	// Disable client when current node is an agent
 	if _os.GetEnv("SERVER_ROLE") != "Agent" {
 
+		// Send heartbeats to the agents, and watch over the commands forwarded to them
+		go _server.WatchAgents()
+
 		// Load embed assets as a filesystem
 		serverRoot := _fs.Sub(clientAssets, "client")
 
@@ -247,6 +354,39 @@ func main() {
 			http.ServeFile(w, r, "custom.css")
 		})
 
+		// HTTP - Set up the OpenID Connect login routes (authorization-code flow)
+		if _os.GetEnv("OIDC_ENABLED") == "TRUE" {
+			http.HandleFunc("/auth/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+				_server.SingleSignOn.Login(w, r)
+			})
+			http.HandleFunc("/auth/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+				_server.SingleSignOn.Callback(&_server, w, r)
+			})
+		}
+
+		// HTTP - Set up the REST API, mirroring the websocket commands
+		http.HandleFunc(server.APIPrefix, func(w http.ResponseWriter, r *http.Request) {
+			_server.HandleAPI(w, r)
+		})
+		http.HandleFunc(server.OpenAPIPath, func(w http.ResponseWriter, r *http.Request) {
+			_server.HandleOpenAPI(w, r)
+		})
+
+		// HTTP - Set up the health and readiness probes
+		http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			_server.HandleHealth(w, r)
+		})
+		http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+			_server.HandleReady(w, r)
+		})
+
+		// HTTP - Set up the Prometheus metrics endpoint
+		if _os.GetEnv("METRICS_ENABLED") == "TRUE" {
+			http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+				_server.HandleMetrics(w, r)
+			})
+		}
+
 		// Use on-disk assets rather than embedded ones when in development
 		if _os.GetEnv("DEV_ENABLED") != "TRUE" {
 			// HTTP - Set up static file serving for all the front-end files
@@ -263,18 +403,40 @@ func main() {
 
 	// WS - Handle first user connecion
 	_server.Melody.HandleConnect(func(session *melody.Session) {
+		// Refuse the connection when its address is allowed neither as a client, nor as an agent
+		if !server.AcceptConnection(session) {
+			session.CloseWithMsg(websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Your address isn't allowed"))
+			return
+		}
+
 		session.Set("id", uuid.NewString())
 
 		// Handle Forward Proxy Header Authentication if enabled
-		if _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_ENABLED") == "TRUE" {
-			requiredHeaderKey := _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_HEADER_KEY")
-			requiredHeaderValue := _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_HEADER_VALUE")
-
-			suppliedHeaderValue := session.Request.Header.Get(requiredHeaderKey)
+		if _server.AuthenticateForwardProxy(session, session.Request) {
+			_server.SendNotification(session, ui.NotificationAuth(ui.NP{
+				Type: ui.TypeSuccess,
+				Content: ui.JSON{
+					"Authentication": ui.JSON{
+						"Spontaneous": true,
+						"Message":     "You are now authenticated",
+					},
+				},
+			}))
+		}
 
-			if suppliedHeaderValue != "" {
-				if requiredHeaderValue == "*" || suppliedHeaderValue == requiredHeaderValue {
-					session.Set("authenticated", true)
+		// Handle API Token Authentication if supplied (Authorization: Bearer header, used by automation clients)
+		if authenticated, _ := session.Get("authenticated"); authenticated != true && _os.GetEnv("AUTHENTICATION_ENABLED") == "TRUE" {
+			if supplied, err := _server.AuthenticateRequest(session, session.Request); supplied {
+				if err != nil {
+					_server.SendNotification(session, ui.NotificationAuth(ui.NP{
+						Type: ui.TypeError,
+						Content: ui.JSON{
+							"Authentication": ui.JSON{
+								"Message": err.Error(),
+							},
+						},
+					}))
+				} else {
 					_server.SendNotification(session, ui.NotificationAuth(ui.NP{
 						Type: ui.TypeSuccess,
 						Content: ui.JSON{
@@ -288,6 +450,40 @@ func main() {
 			}
 		}
 
+		// Handle OpenID Connect Authentication if enabled (session cookie set after login on the provider)
+		if authenticated, _ := session.Get("authenticated"); authenticated != true &&
+			_os.GetEnv("OIDC_ENABLED") == "TRUE" && _os.GetEnv("AUTHENTICATION_ENABLED") == "TRUE" {
+			claims, err := _server.SingleSignOn.Authenticate(&_server, session.Request)
+
+			if err == nil {
+				session.Set("token", claims)
+				session.Set("authenticated", true)
+				session.Set("role", claims.Role)
+				session.Set("user", claims.User)
+				_server.SendNotification(session, ui.NotificationAuth(ui.NP{
+					Type: ui.TypeSuccess,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Spontaneous": true,
+							"Message":     "You are now authenticated",
+						},
+						"Preferences": _server.GetPreferences(),
+					},
+				}))
+			} else {
+				// Let the client offer the OpenID Connect login alongside the password prompt
+				_server.SendNotification(session, ui.NotificationAuth(ui.NP{
+					Type: ui.TypeInfo,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message":      "You can log in using Single Sign-On",
+							"SingleSignOn": "/auth/oidc/login",
+						},
+					},
+				}))
+			}
+		}
+
 		_server.Handle(session)
 	})
 
@@ -315,19 +511,8 @@ func main() {
 
 			// Unregister the agent node if applicable
 			if agent, exists := s.Get("agent"); exists {
-				newAgents := make(server.AgentsArray, 0)
-				for _, _agent := range _server.Agents {
-					if (agent.(server.Agent)).Name != _agent.Name {
-						newAgents = append(newAgents, _agent)
-					}
-				}
-				_server.Agents = newAgents
-
 				s.UnSet("agent")
-
-				// Notify all the clients about the agent's disconnection
-				notification := ui.NotificationData(ui.NotificationParams{Content: ui.JSON{"Agents": _server.Agents.ToStrings()}})
-				_server.Melody.Broadcast(notification.ToBytes())
+				_server.UnregisterAgent(agent.(server.Agent).Name)
 			}
 		}
 
@@ -338,15 +523,23 @@ func main() {
 		hasRegisteredSuccessfullyAtLeastOnce := false
 		lastRegistrationAttemptAt := time.Now().Unix()
 		retryDelay := _strconv.ParseInt(_os.GetEnv("AGENT_REGISTRATION_RETRY_DELAY"), 10, 64)
+		failedAuthentications := 0
 
 	agentRegistration:
 		log.Print("Initiating registration with master node")
 
 		var response ui.Notification
 
-		// 1. Establish connection with Master node
-		masterAddress := url.URL{Scheme: "ws", Host: _os.GetEnv("MASTER_HOST"), Path: "/ws"}
-		connection, _, err := websocket.DefaultDialer.Dial(masterAddress.String(), nil)
+		// 1. Establish connection with Master node (over wss, with the agent's certificate, when TLS is enabled)
+		dialer, scheme, err := server.MasterDialer()
+		if err != nil {
+			log.Print("Error loading the TLS settings of the agent")
+			log.Print(err)
+			return
+		}
+
+		masterAddress := url.URL{Scheme: scheme, Host: _os.GetEnv("MASTER_HOST"), Path: "/ws"}
+		connection, _, err := dialer.Dial(masterAddress.String(), nil)
 		if err != nil {
 			log.Print("Error establishing connection to the master node")
 			log.Print(err)
@@ -371,7 +564,10 @@ func main() {
 			log.Print("Performing authentication")
 
 			// 2. Send authentication command
-			authCommand := ui.Command{Action: "auth.login", Args: ui.JSON{"Password": _os.GetEnv("MASTER_SECRET")}}
+			authCommand := ui.Command{
+				Action: "auth.login",
+				Args:   ui.JSON{"Password": _os.GetEnv("MASTER_SECRET"), "Username": _os.GetEnv("MASTER_USERNAME")},
+			}
 			err = connection.WriteMessage(websocket.TextMessage, _json.Marshal(authCommand))
 			if err != nil {
 				log.Print("Error sending authentication command to the master node")
@@ -387,11 +583,37 @@ func main() {
 				return
 			}
 
+			// Quirk : When OpenID Connect is enabled, the server has already initially sent a login offer
+			//         Skip it, and read the actual authentication response
+			if details, ok := response.Content["Authentication"].(map[string]interface{}); ok && response.Type == ui.TypeInfo {
+				if _, isOffer := details["SingleSignOn"]; isOffer {
+					response = ui.Notification{}
+					if err = connection.ReadJSON(&response); err != nil {
+						log.Print("Error decoding authentication response from the master node")
+						log.Print(err)
+						return
+					}
+				}
+			}
+
+			// Retry later rather than exiting, as Master may be refusing attempts temporarily (e.g. throttling)
+			// The delay is doubled after every failed attempt, to avoid hammering Master with a wrong secret
 			if response.Type != ui.TypeSuccess {
 				log.Print("Authentication with master node unsuccessful")
-				log.Print("Please check your MASTER_SECRET setting and restart")
-				return
+				if details, ok := response.Content["Authentication"].(map[string]interface{}); ok {
+					log.Printf("Error : %s", details["Message"])
+				}
+				connection.Close()
+
+				nextAttemptDelay := max(retryDelay, 1) << min(failedAuthentications, 6)
+				failedAuthentications += 1
+
+				log.Printf("Please check your MASTER_SECRET setting. New attempt in %d seconds", nextAttemptDelay)
+				time.Sleep(time.Duration(nextAttemptDelay) * time.Second)
+				lastRegistrationAttemptAt = time.Now().Unix()
+				goto agentRegistration
 			}
+			failedAuthentications = 0
 
 			// Quirk : When authentication is disabled, the server has already initially sent an auth success
 			//         Trying to empty / vaccuum the message queue proves unfeasible with Gorilla Websocket
@@ -446,7 +668,17 @@ func main() {
 		// Workaround : Create a tweaked reimplementation of melody.Session to reuse existing code
 		session := _session.Create(connection)
 
-		// 6. Process the commands as they are received
+		// 6. Process the commands as they are received, one after the other
+		//    Heartbeats are answered by the reader itself, so that a long-running command doesn't get the agent evicted
+		received := make(chan []byte, 256)
+		handled := make(chan struct{})
+		go func() {
+			for message := range received {
+				_server.Handle(session, message)
+			}
+			close(handled)
+		}()
+
 		masterConnectionLost := false
 		for {
 			_, message, err := connection.ReadMessage()
@@ -457,9 +689,16 @@ func main() {
 				break
 			}
 
-			_server.Handle(session, message)
+			if _server.AnswerHeartbeat(session, message) {
+				continue
+			}
+
+			received <- message
 		}
 
+		close(received)
+		<-handled
+
 		// 7. Clear all opened TTY / Stream instances when applicable
 		session.UnSet("initiator")
 
@@ -489,7 +728,18 @@ func main() {
 	// When current node is master, start the HTTP server
 	if _os.GetEnv("SERVER_ROLE") == "Master" {
 		log.Printf("Server starting on port %s", _os.GetEnv("SERVER_PORT"))
-		if _os.GetEnv("SSL_ENABLED") == "TRUE" {
+		if _os.GetEnv("SSL_ENABLED") == "TRUE" && _os.GetEnv("AGENT_CA_FILE") != "" {
+			// Mutual TLS : Request certificates from agents, and verify them against the CA bundle
+			config, err := server.AgentsTLSConfig()
+			if err != nil {
+				log.Print("Error loading the agents' CA bundle, abort")
+				log.Print(err)
+				return
+			}
+
+			s := &http.Server{Addr: fmt.Sprintf(":%s", _os.GetEnv("SERVER_PORT")), TLSConfig: config}
+			s.ListenAndServeTLS("certificate.pem", "key.pem")
+		} else if _os.GetEnv("SSL_ENABLED") == "TRUE" {
 			http.ListenAndServeTLS(fmt.Sprintf(":%s", _os.GetEnv("SERVER_PORT")), "certificate.pem", "key.pem", nil)
 		} else {
 			http.ListenAndServe(fmt.Sprintf(":%s", _os.GetEnv("SERVER_PORT")), nil)
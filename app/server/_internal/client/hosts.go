@@ -0,0 +1,328 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Represent the transport options of a Docker host
+type HostOptions struct {
+	CA         string // TLS : Path to the CA certificate used to verify the daemon
+	Cert       string // TLS : Path to the client certificate
+	Key        string // TLS : Path to the client certificate's private key
+	Identity   string // SSH : Path to the private key (the SSH agent is used when empty)
+	KnownHosts string // SSH : Path to the known_hosts file (~/.ssh/known_hosts when empty)
+	Version    string // API version to use, instead of negotiating it with the daemon
+}
+
+// Represent what's needed to reach a host outside the SDK (docker CLI), and to release its resources
+type hostEntry struct {
+	address string
+	cli     []string
+	tunnel  *sshTunnel
+}
+
+// Clients created through NewHostClient, and their entries
+var hosts = struct {
+	sync.Mutex
+	entries map[*client.Client]hostEntry
+}{entries: make(map[*client.Client]hostEntry)}
+
+// Create a client for the given host, using the given transport options
+// ssh:// addresses are reached through an SSH tunnel to the remote Docker socket, which the docker CLI
+// reaches through a local socket (so that it uses the host's identity and known_hosts options too)
+func NewHostClient(address string, options HostOptions) (*client.Client, error) {
+	opts := make([]client.Opt, 0)
+	cli := []string{"-H", address}
+	var tunnel *sshTunnel
+
+	if strings.HasPrefix(address, "ssh://") {
+		var err error
+		tunnel, err = newSSHTunnel(address, options)
+		if err != nil {
+			return nil, err
+		}
+
+		socket, err := tunnel.Serve()
+		if err != nil {
+			tunnel.Close()
+			return nil, fmt.Errorf("SSH tunnel can't be served locally -> %s", err)
+		}
+
+		cli = []string{"-H", socket}
+		opts = append(opts, client.WithHost("http://"+tunnel.hostname), client.WithDialContext(tunnel.DialContext))
+	} else {
+		opts = append(opts, client.WithHost(address))
+	}
+
+	if options.CA != "" || options.Cert != "" || options.Key != "" {
+		for _, path := range []string{options.CA, options.Cert, options.Key} {
+			if _, err := os.Stat(path); path != "" && err != nil {
+				return nil, fmt.Errorf("TLS file unavailable -> %s", err)
+			}
+		}
+		opts = append(opts, client.WithTLSClientConfig(options.CA, options.Cert, options.Key))
+
+		if options.CA != "" {
+			cli = append(cli, "--tlsverify", "--tlscacert", options.CA)
+		} else {
+			cli = append(cli, "--tls")
+		}
+		if options.Cert != "" {
+			cli = append(cli, "--tlscert", options.Cert, "--tlskey", options.Key)
+		}
+	}
+
+	if options.Version != "" {
+		opts = append(opts, client.WithVersion(options.Version))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
+	}
+
+	c, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		if tunnel != nil {
+			tunnel.Close()
+		}
+		return nil, err
+	}
+
+	hosts.Lock()
+	defer hosts.Unlock()
+	hosts.entries[c] = hostEntry{address: address, cli: cli, tunnel: tunnel}
+
+	return c, nil
+}
+
+// Retrieve the address of the host the client was created for (as declared, e.g. ssh://user@host)
+func Address(c *client.Client) string {
+	hosts.Lock()
+	defer hosts.Unlock()
+
+	if entry, exists := hosts.entries[c]; exists {
+		return entry.address
+	}
+
+	return c.DaemonHost()
+}
+
+// Build a docker CLI command targeting the same host as the client, with the same TLS options
+func Command(c *client.Client, args ...string) *exec.Cmd {
+	hosts.Lock()
+	cli := []string{"-H", c.DaemonHost()}
+	if entry, exists := hosts.entries[c]; exists {
+		cli = entry.cli
+	}
+	hosts.Unlock()
+
+	return exec.Command("docker", append(append([]string{}, cli...), args...)...)
+}
+
+// Close the client, and its SSH tunnel if any
+func Close(c *client.Client) {
+	hosts.Lock()
+	entry, exists := hosts.entries[c]
+	delete(hosts.entries, c)
+	hosts.Unlock()
+
+	c.Close()
+	if exists && entry.tunnel != nil {
+		entry.tunnel.Close()
+	}
+}
+
+// Represent a long-lived SSH connection, used to reach a remote Docker socket
+type sshTunnel struct {
+	hostname string
+	address  string // host:port
+	socket   string
+	config   *ssh.ClientConfig
+
+	agent net.Conn // Connection to the SSH agent, when used
+
+	listener  net.Listener // Local socket forwarding to the remote Docker socket, for the docker CLI
+	directory string       // Private directory holding the local socket
+
+	mutex  sync.Mutex
+	client *ssh.Client
+}
+
+func newSSHTunnel(address string, options HostOptions) (*sshTunnel, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+
+	socket := u.Path
+	if socket == "" || socket == "/" {
+		socket = "/var/run/docker.sock"
+	}
+
+	// Authentication : Private key file, or SSH agent
+	var auth ssh.AuthMethod
+	var agentConnection net.Conn
+	if options.Identity != "" {
+		raw, err := os.ReadFile(options.Identity)
+		if err != nil {
+			return nil, fmt.Errorf("SSH identity unavailable -> %s", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("SSH identity can't be used (passphrase-protected keys must be loaded in the SSH agent) -> %s", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else {
+		agentConnection, err = net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			return nil, fmt.Errorf("No SSH identity was provided, and the SSH agent is unavailable -> %s", err)
+		}
+		auth = ssh.PublicKeysCallback(agent.NewClient(agentConnection).Signers)
+	}
+
+	// Host key verification
+	knownHostsPath := options.KnownHosts
+	if knownHostsPath == "" {
+		home, _ := os.UserHomeDir()
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		if agentConnection != nil {
+			agentConnection.Close()
+		}
+		return nil, fmt.Errorf("SSH known hosts unavailable -> %s", err)
+	}
+
+	return &sshTunnel{
+		hostname: u.Hostname(),
+		address:  net.JoinHostPort(u.Hostname(), port),
+		socket:   socket,
+		agent:    agentConnection,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{auth},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+	}, nil
+}
+
+// Open a connection to the remote Docker socket, (re)connecting over SSH when needed
+func (t *sshTunnel) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.client != nil {
+		if conn, err := t.client.Dial("unix", t.socket); err == nil {
+			return conn, nil
+		}
+
+		// The SSH connection was lost, establish it again
+		t.client.Close()
+		t.client = nil
+	}
+
+	raw, err := (&net.Dialer{Timeout: t.config.Timeout}).DialContext(ctx, "tcp", t.address)
+	if err != nil {
+		return nil, err
+	}
+
+	connection, channels, requests, err := ssh.NewClientConn(raw, t.address, t.config)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	t.client = ssh.NewClient(connection, channels, requests)
+
+	return t.client.Dial("unix", t.socket)
+}
+
+// Serve the tunnel on a local unix socket, in a private directory, and return the socket's address
+func (t *sshTunnel) Serve() (string, error) {
+	directory, err := os.MkdirTemp("", "isaiah-ssh-")
+	if err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(directory, "docker.sock"))
+	if err != nil {
+		os.RemoveAll(directory)
+		return "", err
+	}
+	t.listener, t.directory = listener, directory
+
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go t.forward(local)
+		}
+	}()
+
+	return "unix://" + listener.Addr().String(), nil
+}
+
+// Relay a local connection to the remote Docker socket, until the remote side is done
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.DialContext(context.Background(), "unix", t.socket)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	go func() {
+		io.Copy(remote, local)
+		if c, ok := remote.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+	}()
+
+	io.Copy(local, remote)
+}
+
+// Close the SSH connection, if established, and the local socket, if served
+func (t *sshTunnel) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.listener != nil {
+		t.listener.Close()
+		os.RemoveAll(t.directory)
+	}
+	if t.agent != nil {
+		t.agent.Close()
+	}
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Represent a single measure, as exposed to Prometheus
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Represent a monotonic counter, split by labels
+type CounterVec struct {
+	mutex  sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Default upper bounds of histograms' buckets, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Represent a histogram, split by labels
+type HistogramVec struct {
+	Buckets []float64 // Upper bounds, in ascending order (DefaultBuckets when empty)
+
+	mutex  sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // Per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// Increase the counter identified by the given label values
+func (c *CounterVec) Add(value float64, labels ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.series == nil {
+		c.series = make(map[string]*counterSeries)
+	}
+
+	key := strings.Join(labels, "\x00")
+	if _, exists := c.series[key]; !exists {
+		c.series[key] = &counterSeries{labels: labels}
+	}
+	c.series[key].value += value
+}
+
+// Write the counter in the Prometheus text format, with the given label names
+func (c *CounterVec) Write(w io.Writer, name string, help string, labelNames ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	writeHeader(w, name, help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labelNames, s.labels), formatValue(s.value))
+	}
+}
+
+// Record an observation in the histogram identified by the given label values
+func (h *HistogramVec) Observe(value float64, labels ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.series == nil {
+		h.series = make(map[string]*histogramSeries)
+	}
+	if len(h.Buckets) == 0 {
+		h.Buckets = DefaultBuckets
+	}
+
+	key := strings.Join(labels, "\x00")
+	if _, exists := h.series[key]; !exists {
+		h.series[key] = &histogramSeries{labels: labels, counts: make([]uint64, len(h.Buckets))}
+	}
+
+	s := h.series[key]
+	for i, bound := range h.Buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Write the histogram in the Prometheus text format, with the given label names
+func (h *HistogramVec) Write(w io.Writer, name string, help string, labelNames ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, name, help, "histogram")
+	bucketNames := append(append([]string{}, labelNames...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		bucketValues := append(append([]string{}, s.labels...), "")
+
+		cumulative := uint64(0)
+		for i, bound := range h.Buckets {
+			cumulative += s.counts[i]
+			bucketValues[len(bucketValues)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketNames, bucketValues), cumulative)
+		}
+
+		bucketValues[len(bucketValues)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketNames, bucketValues), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labelNames, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labelNames, s.labels), s.count)
+	}
+}
+
+// Write a gauge in the Prometheus text format, made of the given samples
+func WriteGauge(w io.Writer, name string, help string, samples []Sample) {
+	writeHeader(w, name, help, "gauge")
+	for _, s := range samples {
+		names := make([]string, 0, len(s.Labels))
+		for n := range s.Labels {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		values := make([]string, 0, len(names))
+		for _, n := range names {
+			values = append(values, s.Labels[n])
+		}
+
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(names, values), formatValue(s.Value))
+	}
+}
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// Format the given labels as {name="value",...} (nothing when there's none)
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(names))
+	for i, n := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, n, escaper.Replace(value)))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
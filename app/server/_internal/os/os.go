@@ -3,6 +3,7 @@ package os
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"will-moss/isaiah/server/_internal/tty"
 
@@ -88,3 +89,29 @@ func VirtualMemory() *mem.VirtualMemoryStat {
 
 	return v
 }
+
+// Write data to the given file atomically (temporary file in the same directory, then rename)
+func WriteFileAtomically(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
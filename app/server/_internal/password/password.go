@@ -0,0 +1,120 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Default parameters used when generating argon2id hashes
+const (
+	argon2Memory  = 64 * 1024
+	argon2Time    = 3
+	argon2Threads = 4
+	argon2KeySize = 32
+	argon2SaltLen = 16
+)
+
+// Determine whether the given hash uses the bcrypt format ($2a$, $2b$, $2y$)
+func IsBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Determine whether the given hash uses the argon2id format ($argon2id$)
+func IsArgon2id(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Determine whether the given hash uses the deprecated unsalted sha256 format
+func IsLegacy(hash string) bool {
+	return hash != "" && !IsBcrypt(hash) && !IsArgon2id(hash)
+}
+
+// Verify the given password against a hash, detecting its format from its prefix
+func Verify(password string, hash string) bool {
+	switch true {
+	case IsBcrypt(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case IsArgon2id(hash):
+		return verifyArgon2id(password, hash)
+	default:
+		hasher := sha256.New()
+		hasher.Write([]byte(password))
+		hashed := fmt.Sprintf("%x", hasher.Sum(nil))
+
+		return subtle.ConstantTimeCompare([]byte(hashed), []byte(strings.ToLower(hash))) == 1
+	}
+}
+
+// Generate a salted hash of the given password using the given algorithm ("bcrypt" or "argon2id")
+func Hash(password string, algorithm string) (string, error) {
+	switch algorithm {
+	case "bcrypt":
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hashed), err
+	case "argon2id":
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeySize)
+
+		return fmt.Sprintf(
+			"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version,
+			argon2Memory,
+			argon2Time,
+			argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("Unsupported hashing algorithm : %s (available: bcrypt, argon2id)", algorithm)
+	}
+}
+
+// Verify the given password against an encoded argon2id hash
+// Expected format : $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func verifyArgon2id(password string, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	// Zero parameters would make argon2 panic, rather than fail the verification
+	if memory == 0 || time == 0 || threads == 0 {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
@@ -0,0 +1,170 @@
+package redact
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Placeholder shown in place of every sensitive value
+const Mask = "********"
+
+// Represent a set of redaction rules
+// A value is sensitive when its name matches any of the Names (glob patterns, case-insensitive),
+// or when the value itself matches any of the Values (regular expressions)
+type Rules struct {
+	Names  []string
+	Values []*regexp.Regexp
+}
+
+// Pairs found in free-form text (run commands, docker-compose.yml files), as :
+// - "NAME=VALUE" (quoted, as in a run command)
+// - NAME=VALUE / - NAME=VALUE (unquoted, at the beginning of a line)
+// - NAME: VALUE / - NAME: VALUE (YAML mapping, at the beginning of a line)
+var (
+	quotedPair = regexp.MustCompile(`"([A-Za-z_][A-Za-z0-9_.\-]*)=((?:[^"\\\n]|\\.)*)"`)
+	linePair   = regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]*)?)([A-Za-z_][A-Za-z0-9_.\-]*)(=|:[ \t]+)([^\n]*?)[ \t]*$`)
+)
+
+// Build rules from a comma-separated list of name patterns, and a whitespace-separated list of value regexes
+func Compile(names string, values string) (Rules, error) {
+	rules := Rules{Names: make([]string, 0), Values: make([]*regexp.Regexp, 0)}
+
+	for _, pattern := range strings.Split(names, ",") {
+		pattern = strings.ToUpper(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return rules, fmt.Errorf("Invalid name pattern %q -> %s", pattern, err)
+		}
+		rules.Names = append(rules.Names, pattern)
+	}
+
+	for _, expression := range strings.Fields(values) {
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			return rules, fmt.Errorf("Invalid value pattern %q -> %s", expression, err)
+		}
+		rules.Values = append(rules.Values, compiled)
+	}
+
+	return rules, nil
+}
+
+// Determine whether the given named value must be redacted
+func (r Rules) IsSensitive(name string, value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, pattern := range r.Names {
+		if matched, _ := path.Match(pattern, strings.ToUpper(name)); matched {
+			return true
+		}
+	}
+
+	for _, expression := range r.Values {
+		if expression.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retrieve the given named value, or the mask when it must be redacted
+func (r Rules) Value(name string, value string) string {
+	if r.IsSensitive(name, value) {
+		return Mask
+	}
+
+	return value
+}
+
+// Redact a list of environment variables (NAME=VALUE)
+func (r Rules) Env(env []string) []string {
+	redacted := make([]string, 0, len(env))
+
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		if r.IsSensitive(name, value) {
+			entry = name + "=" + Mask
+		}
+		redacted = append(redacted, entry)
+	}
+
+	return redacted
+}
+
+// Redact every pair found in the given free-form text
+func (r Rules) Text(text string) string {
+	text = quotedPair.ReplaceAllStringFunc(text, func(match string) string {
+		parts := quotedPair.FindStringSubmatch(match)
+		if !r.IsSensitive(parts[1], parts[2]) {
+			return match
+		}
+
+		return `"` + parts[1] + "=" + Mask + `"`
+	})
+
+	text = linePair.ReplaceAllStringFunc(text, func(match string) string {
+		parts := linePair.FindStringSubmatch(match)
+		if !r.IsSensitive(parts[2], unquote(parts[4])) {
+			return match
+		}
+
+		return parts[1] + parts[2] + parts[3] + Mask
+	})
+
+	return text
+}
+
+// Put back, in the edited text, the original values of the pairs that were left redacted
+// Used when a redacted text (e.g. a run command) is edited and submitted back
+// Pairs are matched by name, and by order of appearance when a name appears several times
+func Restore(edited string, original string) string {
+	if !strings.Contains(edited, Mask) {
+		return edited
+	}
+
+	for _, expression := range []*regexp.Regexp{quotedPair, linePair} {
+		// Name and value positions in the expression's submatches
+		name, value := 1, 2
+		if expression == linePair {
+			name, value = 2, 4
+		}
+
+		values := make(map[string][]string)
+		for _, parts := range expression.FindAllStringSubmatch(original, -1) {
+			values[parts[name]] = append(values[parts[name]], parts[value])
+		}
+
+		seen := make(map[string]int)
+		edited = expression.ReplaceAllStringFunc(edited, func(match string) string {
+			parts := expression.FindStringSubmatchIndex(match)
+			key := match[parts[2*name]:parts[2*name+1]]
+			occurrence := seen[key]
+			seen[key]++
+
+			if match[parts[2*value]:parts[2*value+1]] != Mask || occurrence >= len(values[key]) {
+				return match
+			}
+
+			return match[:parts[2*value]] + values[key][occurrence] + match[parts[2*value+1]:]
+		})
+	}
+
+	return edited
+}
+
+// Strip the quotes surrounding a YAML / shell value, if any
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
@@ -0,0 +1,75 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Represent the information carried by a signed token
+type Claims struct {
+	ID      string // Unique identifier, used for revocation
+	User    string // Name of the account the token was issued to (empty in single-user mode)
+	Role    string // Role granted at issuance time
+	Expires int64  // Unix timestamp after which the token is no longer valid
+}
+
+var (
+	ErrMalformed = errors.New("The token is malformed")
+	ErrSignature = errors.New("The token's signature is invalid")
+	ErrExpired   = errors.New("The token has expired")
+)
+
+// Create a token carrying the given claims, signed with HMAC-SHA256
+// Format : base64url(JSON claims) + "." + base64url(signature)
+func Sign(claims Claims, key []byte) string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signature(encoded, key))
+}
+
+// Verify the token's signature and expiration, and retrieve its claims
+func Parse(token string, key []byte) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, ErrMalformed
+	}
+
+	supplied, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+
+	if !hmac.Equal(supplied, signature(parts[0], key)) {
+		return claims, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrMalformed
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrMalformed
+	}
+
+	if time.Now().Unix() > claims.Expires {
+		return claims, ErrExpired
+	}
+
+	return claims, nil
+}
+
+// Compute the HMAC-SHA256 signature of the given payload
+func signature(payload string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	_client "will-moss/isaiah/server/_internal/client"
 	_os "will-moss/isaiah/server/_internal/os"
 	"will-moss/isaiah/server/_internal/process"
 	"will-moss/isaiah/server/_internal/tty"
@@ -540,7 +541,7 @@ func (c Container) GetBrowserUrl(client *client.Client) (string, error) {
 
 // Retrieve the run command of the Docker container
 func (c Container) GetRunCommand(client *client.Client) (string, error) {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "inspect", "--format", GetRunCommandTemplate, c.Name).Output()
+	output, err := _client.Command(client, "inspect", "--format", GetRunCommandTemplate, c.Name).Output()
 
 	if err != nil {
 		return "", err
@@ -830,16 +831,10 @@ func (c Container) GetStats(client *client.Client) (ui.InspectorContent, error)
 		}, nil
 	}
 
-	information, err := client.ContainerStatsOneShot(context.Background(), c.ID)
+	statsResult, err := c.GetRawStats(client)
 	if err != nil {
 		return nil, err
 	}
-	defer information.Body.Close()
-
-	var statsResult container.StatsResponse
-	if err := json.NewDecoder(information.Body).Decode(&statsResult); err != nil {
-		return nil, err
-	}
 
 	mainStats := ui.InspectorContentPart{Type: "rows"}
 	rows := make(ui.Rows, 0)
@@ -848,14 +843,10 @@ func (c Container) GetStats(client *client.Client) (ui.InspectorContent, error)
 		row := make(ui.Row)
 		switch field {
 		case "CPU":
-			cpuUsageDelta := statsResult.CPUStats.CPUUsage.TotalUsage - statsResult.PreCPUStats.CPUUsage.TotalUsage
-			cpuTotalUsageDelta := statsResult.CPUStats.SystemUsage - statsResult.PreCPUStats.SystemUsage
-			value := float64(cpuUsageDelta*100) / float64(cpuTotalUsageDelta)
-
-			row["CPU"] = value
+			row["CPU"] = CPUPercent(statsResult)
 			row["_representation"] = []string{"CPU:", fmt.Sprintf("%.2f%%", row["CPU"])}
 		case "Memory":
-			row["Memory"] = float64(statsResult.MemoryStats.Usage*100) / float64(statsResult.MemoryStats.Limit)
+			row["Memory"] = MemoryPercent(statsResult)
 			row["_representation"] = []string{"Memory:", fmt.Sprintf("%.2f%%", row["Memory"])}
 		case "Network":
 			row["Network"] = fmt.Sprintf("%s / %s (RX/TX)", ui.UByteCount(statsResult.Networks["eth0"].RxBytes), ui.UByteCount(statsResult.Networks["eth0"].TxBytes))
@@ -878,3 +869,37 @@ func (c Container) GetStats(client *client.Client) (ui.InspectorContent, error)
 	}, nil
 
 }
+
+// Retrieve a single snapshot of the container's resource usage statistics
+func (c Container) GetRawStats(client *client.Client) (container.StatsResponse, error) {
+	var stats container.StatsResponse
+
+	information, err := client.ContainerStatsOneShot(context.Background(), c.ID)
+	if err != nil {
+		return stats, err
+	}
+	defer information.Body.Close()
+
+	err = json.NewDecoder(information.Body).Decode(&stats)
+	return stats, err
+}
+
+// Compute the container's CPU usage, as a percentage of the host's total CPU time
+func CPUPercent(stats container.StatsResponse) float64 {
+	cpuUsageDelta := stats.CPUStats.CPUUsage.TotalUsage - stats.PreCPUStats.CPUUsage.TotalUsage
+	cpuTotalUsageDelta := stats.CPUStats.SystemUsage - stats.PreCPUStats.SystemUsage
+	if cpuTotalUsageDelta == 0 {
+		return 0
+	}
+
+	return float64(cpuUsageDelta*100) / float64(cpuTotalUsageDelta)
+}
+
+// Compute the container's memory usage, as a percentage of its limit
+func MemoryPercent(stats container.StatsResponse) float64 {
+	if stats.MemoryStats.Limit == 0 {
+		return 0
+	}
+
+	return float64(stats.MemoryStats.Usage*100) / float64(stats.MemoryStats.Limit)
+}
@@ -7,11 +7,11 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path"
 	"sort"
 	"strings"
 	"sync"
+	_client "will-moss/isaiah/server/_internal/client"
 	_os "will-moss/isaiah/server/_internal/os"
 	"will-moss/isaiah/server/_internal/process"
 	"will-moss/isaiah/server/ui"
@@ -182,7 +182,7 @@ func StacksList(client *client.Client) Stacks {
 		return []Stack{}
 	}
 
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "ls", "--format", "json").Output()
+	output, err := _client.Command(client, "compose", "ls", "--format", "json").Output()
 
 	if err != nil {
 		return []Stack{}
@@ -242,7 +242,7 @@ func (stacks Stacks) ToRows(columns []string) ui.Rows {
 
 // Single - Start the stack (docker compose up -d)
 func (s Stack) Up(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-f", s.ConfigFiles, "up", "-d").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-f", s.ConfigFiles, "up", "-d").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -253,7 +253,7 @@ func (s Stack) Up(client *client.Client) error {
 
 // Single - Pause the stack (docker compose pause)
 func (s Stack) Pause(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "pause").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "pause").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -264,7 +264,7 @@ func (s Stack) Pause(client *client.Client) error {
 
 // Single - Unpause the stack (docker compose unpause)
 func (s Stack) Unpause(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "unpause").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "unpause").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -275,7 +275,7 @@ func (s Stack) Unpause(client *client.Client) error {
 
 // Single - Stop the stack (docker compose stop)
 func (s Stack) Stop(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "stop").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "stop").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -286,7 +286,7 @@ func (s Stack) Stop(client *client.Client) error {
 
 // Single - Down the stack (docker compose down)
 func (s Stack) Down(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "down").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "down").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -297,19 +297,19 @@ func (s Stack) Down(client *client.Client) error {
 
 // Single - Update the stack (docker compose down, docker compose pull, docker compose up)
 func (s Stack) Update(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "down").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "down").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
 	}
 
-	output, err = exec.Command("docker", "-H", client.DaemonHost(), "compose", "-f", s.ConfigFiles, "pull").CombinedOutput()
+	output, err = _client.Command(client, "compose", "-f", s.ConfigFiles, "pull").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
 	}
 
-	output, err = exec.Command("docker", "-H", client.DaemonHost(), "compose", "-f", s.ConfigFiles, "up", "-d").CombinedOutput()
+	output, err = _client.Command(client, "compose", "-f", s.ConfigFiles, "up", "-d").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -320,7 +320,7 @@ func (s Stack) Update(client *client.Client) error {
 
 // Single - Restart the stack (docker compose restart)
 func (s Stack) Restart(client *client.Client) error {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "restart").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "restart").CombinedOutput()
 
 	if err != nil {
 		return errors.New(string(output))
@@ -331,7 +331,7 @@ func (s Stack) Restart(client *client.Client) error {
 
 // Inspector - Retrieve the list of services (containers) inside a Docker stack
 func (s Stack) GetServices(client *client.Client) (ui.InspectorContent, error) {
-	output, err := exec.Command("docker", "-H", client.DaemonHost(), "compose", "-p", s.Name, "ps", "-aq").CombinedOutput()
+	output, err := _client.Command(client, "compose", "-p", s.Name, "ps", "-aq").CombinedOutput()
 
 	if err != nil {
 		return nil, errors.New(string(output))
@@ -399,8 +399,6 @@ func (s Stack) GetRawConfig(client *client.Client) (string, error) {
 func (s Stack) GetLogs(client *client.Client, writer io.Writer, showTimestamps bool) (*io.ReadCloser, error) {
 	opts := make([]string, 0)
 
-	opts = append(opts, "-H")
-	opts = append(opts, client.DaemonHost())
 	opts = append(opts, "compose")
 	opts = append(opts, "-p")
 	opts = append(opts, s.Name)
@@ -419,7 +417,7 @@ func (s Stack) GetLogs(client *client.Client, writer io.Writer, showTimestamps b
 		opts = append(opts, "--timestamps")
 	}
 
-	process := exec.Command("docker", opts...)
+	process := _client.Command(client, opts...)
 
 	reader, err := process.StdoutPipe()
 	if err != nil {
@@ -449,14 +447,14 @@ func StackCreate(c *client.Client, m process.LongTaskMonitor, args map[string]in
 		return
 	}
 
-	output, err := exec.Command("docker", "-H", c.DaemonHost(), "compose", "-f", filepath, "config").CombinedOutput()
+	output, err := _client.Command(c, "compose", "-f", filepath, "config").CombinedOutput()
 
 	if err != nil {
 		m.Errors <- errors.New(string(output))
 		return
 	}
 
-	process := exec.Command("docker", "-H", c.DaemonHost(), "compose", "-f", filepath, "up", "-d")
+	process := _client.Command(c, "compose", "-f", filepath, "up", "-d")
 	reader, err := process.StdoutPipe()
 
 	if err != nil {
@@ -509,7 +507,7 @@ func (s Stack) Edit(c *client.Client, m process.LongTaskMonitor, args map[string
 		return
 	}
 
-	output, err := exec.Command("docker", "-H", c.DaemonHost(), "compose", "-f", s.ConfigFiles, "config").CombinedOutput()
+	output, err := _client.Command(c, "compose", "-f", s.ConfigFiles, "config").CombinedOutput()
 
 	if err != nil {
 		m.Errors <- errors.New(string(output))
@@ -518,7 +516,7 @@ func (s Stack) Edit(c *client.Client, m process.LongTaskMonitor, args map[string
 		return
 	}
 
-	process := exec.Command("docker", "-H", c.DaemonHost(), "compose", "-f", s.ConfigFiles, "up", "-d")
+	process := _client.Command(c, "compose", "-f", s.ConfigFiles, "up", "-d")
 	reader, err := process.StdoutPipe()
 
 	if err != nil {
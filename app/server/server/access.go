@@ -0,0 +1,182 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+
+	"github.com/olahol/melody"
+)
+
+// Kinds of peers that can connect to the Master node, each with their own access rules
+const (
+	PeerClient = "CLIENTS"
+	PeerAgent  = "AGENTS"
+)
+
+// Parse a comma-separated list of CIDR ranges / single IP addresses
+func parseNetworks(raw string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Single IP address, turned into a /32 or /128 range
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Ignoring invalid IP address in access rules : %s", entry)
+				continue
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid CIDR range in access rules : %s", entry)
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// Determine whether the given IP address belongs to any of the given networks
+func containsAddress(networks []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Determine whether the given address may connect as the given kind of peer
+// using the ACCESS_<KIND>_ALLOW and ACCESS_<KIND>_DENY settings
+// - The deny-list always takes precedence
+// - When the allow-list is empty, every address that isn't denied is allowed
+func IsAddressAllowed(address string, peer string) bool {
+	if containsAddress(parseNetworks(_os.GetEnv("ACCESS_"+peer+"_DENY")), address) {
+		return false
+	}
+
+	allowed := parseNetworks(_os.GetEnv("ACCESS_" + peer + "_ALLOW"))
+	if len(allowed) == 0 {
+		return true
+	}
+
+	return containsAddress(allowed, address)
+}
+
+// Retrieve the address of the client that made the given HTTP request
+// When the request comes from a trusted proxy (TRUSTED_PROXIES setting), the X-Forwarded-For header is
+// read from right to left, and the first address that isn't a trusted proxy is used
+func requestAddress(r *http.Request) string {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		address = r.RemoteAddr
+	}
+
+	proxies := parseNetworks(_os.GetEnv("TRUSTED_PROXIES"))
+	if len(proxies) == 0 || !containsAddress(proxies, address) {
+		return address
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		address = hop
+		if !containsAddress(proxies, hop) {
+			break
+		}
+	}
+
+	return address
+}
+
+// Verify that the session's address is allowed to act as the given kind of peer, and log refusals
+func checkPeerAccess(session _session.GenericSession, peer string) bool {
+	address := sessionAddress(session)
+	if IsAddressAllowed(address, peer) {
+		return true
+	}
+
+	log.Printf("Refused connection from %s (denied by the access rules for %s)", address, strings.ToLower(peer))
+	return false
+}
+
+// Determine whether a new connection to the Master node may proceed (as a client, or as an agent)
+func AcceptConnection(session *melody.Session) bool {
+	if _os.GetEnv("SERVER_ROLE") != "Master" {
+		return true
+	}
+
+	address := requestAddress(session.Request)
+	if IsAddressAllowed(address, PeerClient) || IsAddressAllowed(address, PeerAgent) {
+		return true
+	}
+
+	log.Printf("Refused connection from %s (not allowed as a client, nor as an agent)", address)
+	return false
+}
+
+// Commands agents run before registering, exempt from the clients' rules for the addresses allowed as agents
+var peerExemptCommands = []string{"auth.login", "auth.resume", "auth.logout"}
+
+// Determine whether the session's address may run the commands that precede an agent's registration
+// without being allowed as a client, which requires an explicit allow-list for agents
+// (otherwise every address would be allowed as an agent, and escape the clients' deny-list)
+func isAgentAddress(session _session.GenericSession) bool {
+	if len(parseNetworks(_os.GetEnv("ACCESS_"+PeerAgent+"_ALLOW"))) == 0 {
+		return false
+	}
+
+	return IsAddressAllowed(sessionAddress(session), PeerAgent)
+}
+
+// Determine whether the session's address is allowed to run the given command
+// Agents are checked on registration, and clients on every other command
+func isPeerAllowed(session _session.GenericSession, action string) bool {
+	if _os.GetEnv("SERVER_ROLE") != "Master" {
+		return true
+	}
+
+	if action == "agent.register" {
+		return checkPeerAccess(session, PeerAgent)
+	}
+
+	if _, isAgent := session.Get("agent"); isAgent {
+		return true
+	}
+
+	// Logging in / out precedes the registration of agents, whose addresses follow their own rules
+	if slices.Contains(peerExemptCommands, action) && isAgentAddress(session) {
+		return true
+	}
+
+	return checkPeerAccess(session, PeerClient)
+}
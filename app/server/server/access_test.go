@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// Logging in escapes the clients' rules only from the addresses explicitly allowed as agents
+func TestPeerExemptCommands(t *testing.T) {
+	t.Setenv("SERVER_ROLE", "Master")
+	t.Setenv("ACCESS_CLIENTS_DENY", "10.0.0.0/8")
+
+	request := httptest.NewRequest("GET", "/ws", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	session := newAPISession(request)
+
+	t.Setenv("ACCESS_AGENTS_ALLOW", "")
+	if isPeerAllowed(session, "auth.login") {
+		t.Fatal("Expected a denied client to be refused when no agent is explicitly allowed")
+	}
+
+	t.Setenv("ACCESS_AGENTS_ALLOW", "192.168.0.0/16")
+	if isPeerAllowed(session, "auth.login") {
+		t.Fatal("Expected a denied client to be refused when its address isn't allowed as an agent")
+	}
+
+	t.Setenv("ACCESS_AGENTS_ALLOW", "10.0.0.1")
+	if !isPeerAllowed(session, "auth.login") {
+		t.Fatal("Expected an address allowed as an agent to log in")
+	}
+	if isPeerAllowed(session, "container.list") {
+		t.Fatal("Expected an address allowed as an agent to be refused other commands as a client")
+	}
+}
@@ -1,11 +1,21 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
 	"slices"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
 	_session "will-moss/isaiah/server/_internal/session"
+	_strconv "will-moss/isaiah/server/_internal/strconv"
 	"will-moss/isaiah/server/ui"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/olahol/melody"
 )
 
 // Represent an Isaiah agent
@@ -16,6 +26,176 @@ type Agent struct {
 // Represent an array of Isaiah agents
 type AgentsArray []Agent
 
+// Agent statuses, as observed by the Master node through heartbeats
+const (
+	AgentOnline       = "online"       // The agent answered its last heartbeat in time
+	AgentUnresponsive = "unresponsive" // The agent is connected, but didn't answer for AGENT_HEARTBEAT_TIMEOUT seconds
+)
+
+// Represent the health of an agent
+type AgentStatus struct {
+	Status    string
+	LastSeen  time.Time // Last time anything was received from the agent
+	LatencyMs int64     // Round-trip time of the last heartbeat
+}
+
+// Represent the health of every registered agent, safe for concurrent use
+type AgentHeartbeats struct {
+	mutex   sync.Mutex
+	entries map[string]AgentStatus
+}
+
+// Record that something was received from the agent
+// Returns whether the agent was unresponsive until now
+func (h *AgentHeartbeats) seen(name string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.entries == nil {
+		h.entries = make(map[string]AgentStatus)
+	}
+
+	entry := h.entries[name]
+	recovered := entry.Status == AgentUnresponsive
+	entry.Status = AgentOnline
+	entry.LastSeen = time.Now()
+	h.entries[name] = entry
+
+	return recovered
+}
+
+// Record the round-trip time of a heartbeat sent at the given time
+func (h *AgentHeartbeats) pong(name string, sent time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if entry, exists := h.entries[name]; exists {
+		entry.LatencyMs = time.Since(sent).Milliseconds()
+		h.entries[name] = entry
+	}
+}
+
+// Mark unresponsive the agents that weren't seen for the given duration
+// Returns the agents that just became unresponsive
+func (h *AgentHeartbeats) expire(timeout time.Duration) []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	expired := make([]string, 0)
+	for name, entry := range h.entries {
+		if entry.Status == AgentOnline && time.Since(entry.LastSeen) > timeout {
+			entry.Status = AgentUnresponsive
+			h.entries[name] = entry
+			expired = append(expired, name)
+		}
+	}
+
+	return expired
+}
+
+// Forget the agent's health, once it's unregistered
+func (h *AgentHeartbeats) forget(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.entries, name)
+}
+
+// Retrieve the health of the given agents
+func (h *AgentHeartbeats) Status(names []string) map[string]AgentStatus {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	statuses := make(map[string]AgentStatus, len(names))
+	for _, name := range names {
+		if entry, exists := h.entries[name]; exists {
+			statuses[name] = entry
+		}
+	}
+
+	return statuses
+}
+
+// Represent a command forwarded to an agent, awaiting its first reply
+type pendingForward struct {
+	Agent     string
+	Initiator string
+	Action    string
+	Sequence  int32
+	Since     time.Time
+	Record    *AuditRecord // Audit record completed once the agent replies (nil when the command isn't audited)
+}
+
+// Represent the commands forwarded to agents and awaiting a reply, by agent, initiator, and Sequence, safe for concurrent use
+type AgentForwards struct {
+	mutex   sync.Mutex
+	pending map[string]pendingForward
+}
+
+// Build the key of a forwarded command (commands sent without Sequence by the same initiator share theirs)
+func forwardKey(agent string, initiator string, sequence int32) string {
+	return fmt.Sprintf("%s %s %d", agent, initiator, sequence)
+}
+
+// Register a command forwarded to the agent, unless it doesn't reply on success, or an identical one is already awaiting a reply
+// Returns whether the command is awaiting a reply
+func (f *AgentForwards) add(agent string, command ui.Command, record *AuditRecord) bool {
+	if definition, exists := FindCommand(command.Action); exists && definition.Silent {
+		return false
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.pending == nil {
+		f.pending = make(map[string]pendingForward)
+	}
+
+	key := forwardKey(agent, command.Initiator, command.Sequence)
+	if _, exists := f.pending[key]; exists {
+		return false
+	}
+
+	f.pending[key] = pendingForward{
+		Agent:     agent,
+		Initiator: command.Initiator,
+		Action:    command.Action,
+		Sequence:  command.Sequence,
+		Since:     time.Now(),
+		Record:    record,
+	}
+	return true
+}
+
+// Record that the agent replied to the initiator's command with the given Sequence, and retrieve that command
+func (f *AgentForwards) answered(agent string, initiator string, sequence int32) (pendingForward, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := forwardKey(agent, initiator, sequence)
+	forward, exists := f.pending[key]
+	delete(f.pending, key)
+
+	return forward, exists
+}
+
+// Remove and retrieve the commands awaiting a reply for longer than the given duration
+// (or all the commands forwarded to the given agent, when it's set)
+func (f *AgentForwards) expire(timeout time.Duration, agent string) []pendingForward {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	expired := make([]pendingForward, 0)
+	for key, forward := range f.pending {
+		if (agent != "" && forward.Agent == agent) || (agent == "" && time.Since(forward.Since) > timeout) {
+			expired = append(expired, forward)
+			delete(f.pending, key)
+		}
+	}
+
+	return expired
+}
+
 // Placeholder used for internal organization
 type Agents struct{}
 
@@ -27,20 +207,25 @@ func (handler Agents) RunCommand(server *Server, session _session.GenericSession
 		var agent Agent
 		mapstructure.Decode(command.Args["Resource"], &agent)
 
-		for _, name := range server.Agents.ToStrings() {
-			if name == agent.Name {
-				server.SendNotification(
-					session,
-					ui.NotificationError(ui.NP{Content: ui.JSON{
-						"Message": "This name is already taken. Please use another unique name for your agent",
-					}}),
-				)
-				return
-			}
+		// Mutual TLS : Bind the agent's name to the certificate it presented
+		if err := verifyAgentCertificate(session, agent.Name); err != nil {
+			log.Printf("Refused registration of agent %s from %s -> %s", agent.Name, sessionAddress(session), err)
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			return
+		}
+
+		if !server.registerAgent(agent) {
+			server.SendNotification(
+				session,
+				ui.NotificationError(ui.NP{Content: ui.JSON{
+					"Message": "This name is already taken. Please use another unique name for your agent",
+				}}),
+			)
+			return
 		}
 
 		session.Set("agent", agent)
-		server.Agents = append(server.Agents, agent)
+		server.Heartbeats.seen(agent.Name)
 
 		server.SendNotification(
 			session,
@@ -48,8 +233,7 @@ func (handler Agents) RunCommand(server *Server, session _session.GenericSession
 		)
 
 		// Notify all the clients about the new agent's registration
-		notification := ui.NotificationData(ui.NotificationParams{Content: ui.JSON{"Agents": server.Agents.ToStrings()}})
-		server.Melody.Broadcast(notification.ToBytes())
+		server.BroadcastAgents()
 
 	// Command : Agent replies to a specific client
 	case "agent.reply":
@@ -60,6 +244,21 @@ func (handler Agents) RunCommand(server *Server, session _session.GenericSession
 			return
 		}
 
+		var _notification ui.Notification
+		mapstructure.Decode(command.Args["Notification"], &_notification)
+
+		if agent, isAgent := session.Get("agent"); isAgent {
+			if forward, exists := server.Forwards.answered(agent.(Agent).Name, to, _notification.Sequence); exists && forward.Record != nil {
+				forward.Record.completeWith(_notification)
+				server.Audit.Append(*forward.Record)
+			}
+		}
+
+		// Replies to REST API calls are awaited by the HTTP handler, not by a websocket client
+		if server.APIReplies.deliver(to, _notification) {
+			return
+		}
+
 		sessions, _ := server.Melody.Sessions()
 		for index := range sessions {
 			_session := sessions[index]
@@ -68,16 +267,61 @@ func (handler Agents) RunCommand(server *Server, session _session.GenericSession
 				continue
 			}
 
-			var _notification ui.Notification
-			mapstructure.Decode(command.Args["Notification"], &_notification)
 			_session.Write(_notification.ToBytes())
 			break
 		}
 
 		// -> Agent's "logout" is performed when the websocket connection is terminated
 
+	// Command : Agent answers a heartbeat (its reception was recorded by Handle already)
+	case "agent.pong":
+		var args agentPongArgs
+		mapstructure.Decode(command.Args, &args)
+
+		if agent, isAgent := session.Get("agent"); isAgent {
+			server.Heartbeats.pong(agent.(Agent).Name, time.UnixMilli(args.Sent))
+		}
+
+	// Command : Retrieve the health of the agents
+	case "agent.status":
+		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"AgentsStatus": server.permittedAgentsStatus(session)}}))
+
+	// Command : Master asks for the Docker-level metrics of the agent's host
+	case "agent.metrics":
+		server.SendNotification(
+			session,
+			ui.NotificationData(ui.NP{Content: ui.JSON{"Metrics": CollectDockerMetrics(server.ClientFor(command))}}),
+		)
+
+	}
+
+}
+
+// Agent - Answer Master's heartbeat
+func (server *Server) pong(session _session.GenericSession, ping ui.Command) {
+	server.send(session, ui.Command{Action: "agent.pong", Args: ping.Args}.ToBytes())
+}
+
+// Agent - Answer the given message right away if it's a heartbeat, and report whether it was one
+// Used by the agent's read loop, so that heartbeats are answered even while a long-running command is being handled
+func (server *Server) AnswerHeartbeat(session _session.GenericSession, message []byte) bool {
+	if !bytes.Contains(message, []byte(`"agent.ping"`)) {
+		return false
+	}
+
+	var command ui.Command
+	if err := json.Unmarshal(message, &command); err != nil || command.Action != "agent.ping" {
+		return false
 	}
 
+	server.pong(session, command)
+	return true
+}
+
+// Determine whether the given action is one Master sends to its agents on its own behalf (REST API calls, metrics)
+// Master authorizes these itself, and agents run them without requiring the initiator to authenticate
+func isMasterOriginated(action string) bool {
+	return action == "agent.metrics" || strings.HasPrefix(action, "api.")
 }
 
 func (agents AgentsArray) ToStrings() []string {
@@ -91,3 +335,136 @@ func (agents AgentsArray) ToStrings() []string {
 
 	return arr
 }
+
+// Retrieve the health of the agents the session may access
+func (server *Server) permittedAgentsStatus(session _session.GenericSession) map[string]AgentStatus {
+	return server.Heartbeats.Status(server.permittedAgents(session))
+}
+
+// Notify all the clients about the health of the agents they may access
+func (server *Server) BroadcastAgentsStatus() {
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		if !isAuthenticatedClient(s) {
+			continue
+		}
+
+		notification := ui.NotificationData(ui.NotificationParams{Content: ui.JSON{"AgentsStatus": server.permittedAgentsStatus(s)}})
+		s.Write(notification.ToBytes())
+	}
+}
+
+// Retrieve a copy of the agents currently registered, safe for concurrent use while agents come and go
+func (server *Server) KnownAgents() AgentsArray {
+	server.agentMutex.RLock()
+	defer server.agentMutex.RUnlock()
+
+	return slices.Clone(server.Agents)
+}
+
+// Register the agent, unless another one already uses its name, and report whether it was registered
+func (server *Server) registerAgent(agent Agent) bool {
+	server.agentMutex.Lock()
+	defer server.agentMutex.Unlock()
+
+	if slices.ContainsFunc(server.Agents, func(a Agent) bool { return a.Name == agent.Name }) {
+		return false
+	}
+
+	server.Agents = append(server.Agents, agent)
+	return true
+}
+
+// Unregister the agent, letting the clients awaiting its replies know that they won't come
+func (server *Server) UnregisterAgent(name string) {
+	server.agentMutex.Lock()
+	server.Agents = slices.DeleteFunc(slices.Clone(server.Agents), func(a Agent) bool { return a.Name == name })
+	server.agentMutex.Unlock()
+	server.Heartbeats.forget(name)
+
+	for _, forward := range server.Forwards.expire(0, name) {
+		server.failForward(forward, fmt.Sprintf("The agent %s disconnected before replying", name))
+	}
+
+	// Notify all the clients about the agent's disconnection
+	server.BroadcastAgents()
+}
+
+// Send an error notification to the client whose forwarded command won't be answered, and audit its failure
+func (server *Server) failForward(forward pendingForward, message string) {
+	if forward.Record != nil {
+		forward.Record.Outcome, forward.Record.Message = OutcomeError, message
+		server.Audit.Append(*forward.Record)
+	}
+
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		if id, exists := s.Get("id"); !exists || id != forward.Initiator {
+			continue
+		}
+
+		notification := ui.NotificationError(ui.NP{Content: ui.JSON{"Message": message}})
+		notification.Sequence = forward.Sequence
+		s.Write(notification.ToBytes())
+		break
+	}
+}
+
+// Master - Send heartbeats to the agents, mark unresponsive the ones that don't answer, and evict the ones that stay so
+// Also let the clients know when the commands they forwarded to an agent didn't get any reply in time
+func (server *Server) WatchAgents() {
+	interval := time.Duration(_strconv.ParseInt(_os.GetEnv("AGENT_HEARTBEAT_INTERVAL"), 10, 64)) * time.Second
+	timeout := time.Duration(_strconv.ParseInt(_os.GetEnv("AGENT_HEARTBEAT_TIMEOUT"), 10, 64)) * time.Second
+	eviction := time.Duration(_strconv.ParseInt(_os.GetEnv("AGENT_EVICTION_TIMEOUT"), 10, 64)) * time.Second
+	commandTimeout := time.Duration(_strconv.ParseInt(_os.GetEnv("AGENT_COMMAND_TIMEOUT"), 10, 64)) * time.Second
+
+	lastHeartbeat := time.Time{}
+	for range time.Tick(time.Second) {
+		// Forwarded commands without any reply
+		if commandTimeout > 0 {
+			for _, forward := range server.Forwards.expire(commandTimeout, "") {
+				log.Printf("Agent %s didn't reply in time to %s", forward.Agent, forward.Action)
+				server.failForward(
+					forward,
+					fmt.Sprintf("The agent %s didn't reply in time (%s). It may be busy, or unreachable", forward.Agent, forward.Action),
+				)
+			}
+		}
+
+		if interval <= 0 || time.Since(lastHeartbeat) < interval {
+			continue
+		}
+		lastHeartbeat = time.Now()
+
+		// Heartbeats
+		ping := ui.Command{Action: "agent.ping", Args: ui.JSON{"Sent": time.Now().UnixMilli()}}
+		statuses := server.Heartbeats.Status(server.KnownAgents().ToStrings())
+
+		sessions, _ := server.Melody.Sessions()
+		for _, s := range sessions {
+			agent, isAgent := s.Get("agent")
+			if !isAgent {
+				continue
+			}
+
+			name := agent.(Agent).Name
+			if status, exists := statuses[name]; exists && eviction > 0 && time.Since(status.LastSeen) > eviction {
+				log.Printf("Evicting agent %s, silent for %s", name, time.Since(status.LastSeen).Round(time.Second))
+				s.CloseWithMsg(melody.FormatCloseMessage(melody.CloseGoingAway, fmt.Sprintf("No heartbeat received for %s", eviction)))
+				continue
+			}
+
+			s.Write(ping.ToBytes())
+		}
+
+		// Agents that stopped answering
+		if timeout > 0 {
+			if expired := server.Heartbeats.expire(timeout); len(expired) > 0 {
+				for _, name := range expired {
+					log.Printf("Agent %s is unresponsive", name)
+				}
+				server.BroadcastAgentsStatus()
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+// Agents registering concurrently under the same name are admitted only once
+func TestRegisterAgentIsExclusive(t *testing.T) {
+	server := newTestServer()
+
+	var wg sync.WaitGroup
+	registered := make(chan bool, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registered <- server.registerAgent(Agent{Name: "edge"})
+		}()
+	}
+	wg.Wait()
+	close(registered)
+
+	admitted := 0
+	for r := range registered {
+		if r {
+			admitted++
+		}
+	}
+
+	if admitted != 1 || len(server.KnownAgents()) != 1 {
+		t.Errorf("Expected a single agent to be registered, got %d (%v)", admitted, server.KnownAgents())
+	}
+}
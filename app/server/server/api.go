@@ -0,0 +1,389 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	_strconv "will-moss/isaiah/server/_internal/strconv"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Prefix of every route of the REST API
+const APIPrefix = "/api/v1/"
+
+// Maximum duration the Master node waits for an agent to answer a REST API call
+const apiAgentTimeout = 2 * time.Minute
+
+// Represent a REST API call, as received by the Master node (and forwarded to agents)
+type APIRequest struct {
+	Method   string
+	Resource string  // Collection, as found in the URL (e.g. containers)
+	ID       string  // Identifier of the targeted resource (ID or name), empty when targeting the collection
+	Verb     string  // Action to run, as found in the URL (empty for list / inspect)
+	Args     ui.JSON // Decoded JSON body, if any
+	Reveal   bool    // Whether redacted values should be revealed (inspect only)
+}
+
+// Represent the outcome of a REST API call
+type APIResponse struct {
+	Status int
+	Body   interface{}
+}
+
+// Represent the REST API calls forwarded to agents, and awaiting their reply
+type APIReplies struct {
+	mutex   sync.Mutex
+	pending map[string]chan ui.Notification // Call ID -> Replies
+}
+
+// Register a call awaiting replies, and retrieve the channel where they're delivered
+func (r *APIReplies) wait(id string) chan ui.Notification {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(map[string]chan ui.Notification)
+	}
+
+	replies := make(chan ui.Notification, 8)
+	r.pending[id] = replies
+
+	return replies
+}
+
+// Stop awaiting replies for the given call
+func (r *APIReplies) release(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.pending, id)
+}
+
+// Deliver an agent's reply to the call it's meant for, if any (without blocking)
+func (r *APIReplies) deliver(id string, notification ui.Notification) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	replies, exists := r.pending[id]
+	if !exists {
+		return false
+	}
+
+	select {
+	case replies <- notification:
+	default:
+	}
+
+	return true
+}
+
+// Represent the session of a REST API call
+// It carries the same keys as a websocket session (authenticated, role, user, etc.), and discards what's written to it
+type apiSession struct {
+	mutex   sync.Mutex
+	keys    map[string]interface{}
+	Request *http.Request
+}
+
+func newAPISession(r *http.Request) *apiSession {
+	return &apiSession{keys: map[string]interface{}{"id": uuid.NewString()}, Request: r}
+}
+
+func (s *apiSession) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = value
+}
+
+func (s *apiSession) Get(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, exists := s.keys[key]
+	return value, exists
+}
+
+func (s *apiSession) UnSet(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, key)
+}
+
+func (s *apiSession) Write([]byte) error {
+	return nil
+}
+
+// Build an error response
+func apiError(status int, err error) APIResponse {
+	return APIResponse{Status: status, Body: ui.JSON{"Error": err.Error()}}
+}
+
+// Build a successful response carrying a message
+func apiMessage(message string) APIResponse {
+	return APIResponse{Status: http.StatusOK, Body: ui.JSON{"Message": message}}
+}
+
+// Write the given response as JSON
+func writeAPIResponse(w http.ResponseWriter, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(response.Body)
+}
+
+// Parse the request's path and body into an API call
+// Routes : GET /<resources>, GET /<resources>/<id>, POST /<resources>/<verb>, POST /<resources>/<id>/<verb>
+func parseAPIRequest(r *http.Request) (APIRequest, error) {
+	request := APIRequest{Method: r.Method, Args: ui.JSON{}, Reveal: r.URL.Query().Get("reveal") == "true"}
+
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), APIPrefix), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return request, err
+		}
+		segments = append(segments, unescaped)
+	}
+
+	request.Resource = segments[0]
+	switch {
+	case len(segments) == 2 && r.Method == http.MethodGet:
+		request.ID = segments[1]
+	case len(segments) == 2:
+		request.Verb = segments[1]
+	case len(segments) == 3:
+		request.ID, request.Verb = segments[1], segments[2]
+	case len(segments) > 3:
+		return request, fmt.Errorf("Unknown route")
+	}
+
+	if r.Method == http.MethodPost {
+		raw, err := io.ReadAll(io.LimitReader(r.Body, _strconv.ParseInt(_os.GetEnv("SERVER_MAX_READ_SIZE"), 10, 64)))
+		if err != nil {
+			return request, err
+		}
+
+		if len(strings.TrimSpace(string(raw))) > 0 {
+			if err := json.Unmarshal(raw, &request.Args); err != nil {
+				return request, fmt.Errorf("The request's body must be a JSON object -> %s", err)
+			}
+		}
+	}
+
+	return request, nil
+}
+
+// Authenticate a REST API call using the same methods as the websocket connection
+// (API token in the Authorization header, Forward Proxy header, OpenID Connect session cookie)
+func (server *Server) authenticateAPI(session _session.GenericSession, r *http.Request) error {
+	if _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
+		session.Set("authenticated", true)
+		session.Set("role", RoleAdmin)
+		return nil
+	}
+
+	if supplied, err := server.AuthenticateRequest(session, r); supplied {
+		return err
+	}
+
+	if server.AuthenticateForwardProxy(session, r) {
+		return nil
+	}
+
+	if _os.GetEnv("OIDC_ENABLED") == "TRUE" {
+		if claims, err := server.SingleSignOn.Authenticate(server, r); err == nil {
+			session.Set("authenticated", true)
+			session.Set("role", claims.Role)
+			session.Set("user", claims.User)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Authentication is required (Authorization: Bearer <API token>)")
+}
+
+// HTTP - Handle a call to the REST API (/api/v1/...)
+func (server *Server) HandleAPI(w http.ResponseWriter, r *http.Request) {
+	session := newAPISession(r)
+
+	// Browsers attach the Forward Proxy header and the OpenID Connect cookie to cross-site calls too,
+	// hence the same Origin rules as the websocket's, to prevent cross-site request forgery
+	if !IsOriginAllowed(r) {
+		writeAPIResponse(w, apiError(http.StatusForbidden, fmt.Errorf("Your origin isn't allowed to call the API")))
+		return
+	}
+
+	request, err := parseAPIRequest(r)
+	if err != nil {
+		writeAPIResponse(w, apiError(http.StatusBadRequest, err))
+		return
+	}
+
+	route, status := findAPIRoute(request)
+	if route == nil {
+		writeAPIResponse(w, apiError(status, fmt.Errorf("No route matches %s %s", r.Method, r.URL.Path)))
+		return
+	}
+
+	action := route.Action
+	if request.Reveal && route.Revealable {
+		action += revealSuffix
+	}
+
+	if err := server.authenticateAPI(session, r); err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIResponse(w, apiError(http.StatusUnauthorized, err))
+		return
+	}
+
+	// Host / Agent selection, identical to the websocket's
+	command := ui.Command{
+		Action: action,
+		Host:   r.URL.Query().Get("host"),
+		Agent:  r.URL.Query().Get("agent"),
+		Args:   ui.JSON{"Resource": ui.JSON{"Name": request.ID}},
+	}
+
+	if command.Agent == "Master" {
+		command.Agent = ""
+	}
+	if command.Agent != "" && !slices.Contains(server.KnownAgents().ToStrings(), command.Agent) {
+		writeAPIResponse(w, apiError(http.StatusNotFound, fmt.Errorf("No agent is named %s", command.Agent)))
+		return
+	}
+
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && command.Agent == "" {
+		if command.Host == "" {
+			command.Host = server.sessionHost(session)
+		}
+
+		if !slices.Contains(server.KnownHosts().ToStrings(), command.Host) {
+			writeAPIResponse(w, apiError(http.StatusNotFound, fmt.Errorf("No host is named %s", command.Host)))
+			return
+		}
+	}
+
+	// Same authorization rules as the websocket's
+	switch {
+	case !isPeerAllowed(session, action):
+		err = fmt.Errorf("Your address isn't allowed to run this command : %s", action)
+	case isRefusedByReadOnly(action):
+		err = fmt.Errorf("Isaiah is running in read-only mode, this command is unavailable : %s", action)
+	case !server.IsAllowed(session, action):
+		err = fmt.Errorf("Your role doesn't allow you to run this command : %s", action)
+	case !server.isPermittedByToken(session, command):
+		err = fmt.Errorf("Your API token doesn't allow this command : %s", action)
+	case !server.isPermittedByPolicies(session, command):
+		err = fmt.Errorf("Your account isn't allowed to access this host or agent : %s", action)
+	}
+
+	if err != nil {
+		writeAPIResponse(w, apiError(http.StatusForbidden, err))
+		return
+	}
+
+	// Run the call, or forward it to the agent and wait for its reply
+	var response APIResponse
+	if command.Agent != "" {
+		response = server.forwardAPI(session, command, request)
+	} else {
+		response = route.Run(server.ClientFor(command), request)
+	}
+
+	if isAudited(action) {
+		record := newAuditRecord(session, command)
+		record.Outcome = OutcomeSuccess
+		if response.Status >= 400 {
+			record.Outcome = OutcomeError
+			if body, ok := response.Body.(ui.JSON); ok {
+				record.Message, _ = body["Error"].(string)
+			}
+		}
+		server.Audit.Append(record)
+	}
+
+	writeAPIResponse(w, response)
+}
+
+// Master - Forward a REST API call to an agent, and wait for its reply
+func (server *Server) forwardAPI(session _session.GenericSession, command ui.Command, request APIRequest) APIResponse {
+	id, _ := session.Get("id")
+
+	var agent _session.GenericSession
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		if a, ok := s.Get("agent"); ok && a.(Agent).Name == command.Agent {
+			agent = s
+			break
+		}
+	}
+
+	if agent == nil {
+		return apiError(http.StatusNotFound, fmt.Errorf("No agent is named %s", command.Agent))
+	}
+
+	replies := server.APIReplies.wait(id.(string))
+	defer server.APIReplies.release(id.(string))
+
+	forwarded := ui.Command{
+		Action:    "api." + command.Action,
+		Host:      command.Host,
+		Initiator: id.(string),
+		Args:      ui.JSON{"Request": request},
+	}
+	agent.Write(forwarded.ToBytes())
+
+	timeout := time.After(apiAgentTimeout)
+	for {
+		select {
+		case notification := <-replies:
+			if raw, exists := notification.Content["API"]; exists {
+				var response APIResponse
+				mapstructure.Decode(raw, &response)
+				return response
+			}
+
+			if notification.Type == ui.TypeError {
+				message, _ := notification.Content["Message"].(string)
+				return apiError(http.StatusBadGateway, errors.New(message))
+			}
+
+		case <-timeout:
+			return apiError(http.StatusGatewayTimeout, fmt.Errorf("The agent %s didn't reply in time", command.Agent))
+		}
+	}
+}
+
+// Placeholder used for internal organization
+type API struct{}
+
+// Agent - Run a REST API call forwarded by the Master node, and reply with its outcome
+func (API) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	var request APIRequest
+	mapstructure.Decode(command.Args["Request"], &request)
+
+	var response APIResponse
+	if route, status := findAPIRoute(request); route == nil {
+		response = apiError(status, fmt.Errorf("No route matches %s %s", request.Method, request.Resource))
+	} else {
+		response = route.Run(server.ClientFor(command), request)
+	}
+
+	if response.Status >= 400 {
+		body, _ := response.Body.(ui.JSON)
+		server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"API": response, "Message": body["Error"]}}))
+		return
+	}
+
+	server.SendNotification(session, ui.NotificationSuccess(ui.NP{Content: ui.JSON{"API": response}}))
+}
@@ -0,0 +1,727 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	"will-moss/isaiah/server/_internal/process"
+	"will-moss/isaiah/server/_internal/redact"
+	"will-moss/isaiah/server/resources"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Represent a route of the REST API
+type apiRoute struct {
+	Method     string
+	Resource   string // Collection, as found in the URL (e.g. containers)
+	Single     bool   // Whether the route targets a single resource, identified in the URL
+	Verb       string // Action, as found in the URL (empty for list / inspect)
+	Action     string // Equivalent websocket action, used for authorization and auditing
+	Revealable bool   // Whether the route supports ?reveal=true, to skip redaction
+	Summary    string
+	Args       interface{} // Schema of the JSON body (zero value of the struct it's decoded into)
+	Response   interface{} // Schema of the successful response (zero value of the value it's encoded from)
+	Run        func(client *client.Client, request APIRequest) APIResponse
+}
+
+// Retrieve the route matching the given call, or the status to respond with when none does (404 / 405)
+func findAPIRoute(request APIRequest) (*apiRoute, int) {
+	status := http.StatusNotFound
+
+	for i, route := range apiRoutes {
+		if route.Resource != request.Resource || route.Single != (request.ID != "") || route.Verb != request.Verb {
+			continue
+		}
+
+		if route.Method != request.Method {
+			status = http.StatusMethodNotAllowed
+			continue
+		}
+
+		return &apiRoutes[i], 0
+	}
+
+	return nil, status
+}
+
+// Build an error response from an error returned by Docker
+func apiDockerError(err error) APIResponse {
+	switch {
+	case errdefs.IsNotFound(err):
+		return apiError(http.StatusNotFound, err)
+	case errdefs.IsConflict(err):
+		return apiError(http.StatusConflict, err)
+	case errdefs.IsInvalidParameter(err):
+		return apiError(http.StatusBadRequest, err)
+	}
+
+	return apiError(http.StatusInternalServerError, err)
+}
+
+// Build the response for a resource that couldn't be found
+func apiNotFound(kind string, id string) APIResponse {
+	return apiError(http.StatusNotFound, fmt.Errorf("No %s matches %s", kind, id))
+}
+
+// Retrieve the redaction rules applying to the call, unless it asked to reveal the values
+func apiRedaction(request APIRequest) (redact.Rules, bool) {
+	if request.Reveal {
+		return redact.Rules{}, false
+	}
+
+	return redactionRules("")
+}
+
+// Refuse the calls that require accessing files on a remote host (multi-host deployment)
+func apiRequiresLocalHost(client *client.Client) (APIResponse, bool) {
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(client.DaemonHost(), "unix://") {
+		return apiError(
+			http.StatusNotImplemented,
+			fmt.Errorf("This command requires accessing files on the remote host, which isn't feasible over the raw Docker socket"),
+		), false
+	}
+
+	return APIResponse{}, true
+}
+
+// Refuse the calls that require running the docker CLI on the hosting system, when Isaiah runs inside a container
+func apiRequiresHostSystem() (APIResponse, bool) {
+	if _os.GetEnv("DOCKER_RUNNING") == "TRUE" {
+		return apiError(
+			http.StatusNotImplemented,
+			fmt.Errorf("This command is unavailable when Isaiah runs inside a Docker container"),
+		), false
+	}
+
+	return APIResponse{}, true
+}
+
+// Run a long task to its end, and build the response from its outcome
+func apiRunTask(client *client.Client, function func(*client.Client, process.LongTaskMonitor, map[string]interface{}), args ui.JSON, message string) APIResponse {
+	steps, errs := make([]string, 0), make([]string, 0)
+
+	task := process.LongTask{
+		Function: function,
+		Args:     args,
+		OnStep:   func(update string) { steps = append(steps, update) },
+		OnError:  func(err error) { errs = append(errs, err.Error()) },
+		OnDone:   func() {},
+	}
+	task.RunSync(client)
+
+	if len(errs) > 0 {
+		return APIResponse{Status: http.StatusInternalServerError, Body: ui.JSON{"Error": strings.Join(errs, "\n"), "Steps": steps}}
+	}
+
+	return APIResponse{Status: http.StatusOK, Body: ui.JSON{"Message": message, "Steps": steps}}
+}
+
+// Decode the call's body into the given structure (the route's Args), refusing unknown and missing fields
+func apiArgs(request APIRequest, args interface{}) error {
+	return decodeArgs(request.Args, args)
+}
+
+// Retrieve the container identified by the given ID (full or short) or name
+func findContainer(client *client.Client, id string) (resources.Container, bool) {
+	containers := resources.ContainersList(client, filters.Args{})
+	index := slices.IndexFunc(containers, func(c resources.Container) bool {
+		return c.ID == id || c.Name == id || (len(id) >= 12 && strings.HasPrefix(c.ID, id))
+	})
+
+	if index == -1 {
+		return resources.Container{}, false
+	}
+
+	return containers[index], true
+}
+
+// Retrieve the image identified by the given ID (full or short), name, or name:version
+func findImage(client *client.Client, id string) (resources.Image, bool) {
+	images := resources.ImagesList(client)
+	index := slices.IndexFunc(images, func(i resources.Image) bool {
+		short := strings.TrimPrefix(i.ID, "sha256:")
+		return i.ID == id || i.Name == id || i.Name+":"+i.Version == id || (len(id) >= 12 && strings.HasPrefix(short, id))
+	})
+
+	if index == -1 {
+		return resources.Image{}, false
+	}
+
+	return images[index], true
+}
+
+// Retrieve the volume identified by the given name
+func findVolume(client *client.Client, name string) (resources.Volume, bool) {
+	volumes := resources.VolumesList(client)
+	index := slices.IndexFunc(volumes, func(v resources.Volume) bool { return v.Name == name })
+
+	if index == -1 {
+		return resources.Volume{}, false
+	}
+
+	return volumes[index], true
+}
+
+// Retrieve the network identified by the given ID (full or short) or name
+func findNetwork(client *client.Client, id string) (resources.Network, bool) {
+	networks := resources.NetworksList(client)
+	index := slices.IndexFunc(networks, func(n resources.Network) bool {
+		return n.ID == id || n.Name == id || (len(id) >= 12 && strings.HasPrefix(n.ID, id))
+	})
+
+	if index == -1 {
+		return resources.Network{}, false
+	}
+
+	return networks[index], true
+}
+
+// Retrieve the stack identified by the given name
+func findStack(client *client.Client, name string) (resources.Stack, bool) {
+	stacks := resources.StacksList(client)
+	index := slices.IndexFunc(stacks, func(s resources.Stack) bool { return s.Name == name })
+
+	if index == -1 {
+		return resources.Stack{}, false
+	}
+
+	return stacks[index], true
+}
+
+// Build a route running a single action on a container
+func containerRoute(verb string, action string, summary string, args interface{}, run func(client *client.Client, c resources.Container, request APIRequest) APIResponse) apiRoute {
+	return apiRoute{
+		Method: http.MethodPost, Resource: "containers", Single: true, Verb: verb, Action: action,
+		Summary: summary, Args: args, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			c, found := findContainer(client, request.ID)
+			if !found {
+				return apiNotFound("container", request.ID)
+			}
+
+			return run(client, c, request)
+		},
+	}
+}
+
+// Build a route running a single action on a stack
+func stackRoute(verb string, action string, summary string, run func(s resources.Stack, client *client.Client) error, message string) apiRoute {
+	return apiRoute{
+		Method: http.MethodPost, Resource: "stacks", Single: true, Verb: verb, Action: action,
+		Summary: summary, Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			s, found := findStack(client, request.ID)
+			if !found {
+				return apiNotFound("stack", request.ID)
+			}
+
+			if err := run(s, client); err != nil {
+				return apiError(http.StatusInternalServerError, err)
+			}
+
+			return apiMessage(message)
+		},
+	}
+}
+
+// Build a route running an action on all the stacks, one after another
+func stacksRoute(verb string, action string, summary string, run func(s resources.Stack, client *client.Client) error, message string) apiRoute {
+	return apiRoute{
+		Method: http.MethodPost, Resource: "stacks", Verb: verb, Action: action,
+		Summary: summary, Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			for _, s := range resources.StacksList(client) {
+				if err := run(s, client); err != nil {
+					return apiError(http.StatusInternalServerError, fmt.Errorf("%s -> %s", s.Name, err))
+				}
+			}
+
+			return apiMessage(message)
+		},
+	}
+}
+
+// Build a route pruning the unused resources of a collection
+func pruneRoute(resource string, action string, prune func(client *client.Client) error) apiRoute {
+	return apiRoute{
+		Method: http.MethodPost, Resource: resource, Verb: "prune", Action: action,
+		Summary: "Remove all the unused " + resource, Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			if err := prune(client); err != nil {
+				return apiDockerError(err)
+			}
+
+			return apiMessage(fmt.Sprintf("All the unused %s were pruned", resource))
+		},
+	}
+}
+
+// Arguments of the routes that don't take any
+type apiNoArgs struct{}
+
+// Arguments of POST /containers/<id>/rename
+type apiRenameArgs struct {
+	Name string `required:"true" description:"New name of the container"`
+}
+
+// Arguments of POST /containers/<id>/remove
+type apiContainerRemoveArgs struct {
+	Force         bool `description:"Kill the container if it's running"`
+	RemoveVolumes bool `description:"Remove the anonymous volumes attached to the container"`
+}
+
+// Arguments of POST /containers/<id>/edit
+type apiRunCommandArgs struct {
+	Content string `required:"true" description:"New run command of the container, starting with docker run"`
+}
+
+// Arguments of POST /images/pull
+type apiPullArgs struct {
+	Image string `required:"true" description:"Name of the image to pull (e.g. nginx:latest)"`
+}
+
+// Arguments of POST /images/<id>/remove
+type apiImageRemoveArgs struct {
+	Force bool `description:"Remove the image even if it's used by stopped containers"`
+	Prune bool `description:"Remove the image's untagged parents"`
+}
+
+// Arguments of POST /images/<id>/run
+type apiImageRunArgs struct {
+	Name string `description:"Name of the new container (generated by Docker when empty)"`
+}
+
+// Arguments of POST /volumes/<name>/remove
+type apiVolumeRemoveArgs struct {
+	Force bool `description:"Remove the volume even if it's in use"`
+}
+
+// Arguments of POST /stacks/create and POST /stacks/<name>/edit
+type apiComposeArgs struct {
+	Content string `required:"true" description:"Content of the docker-compose.yml file"`
+}
+
+// Response of the routes that run an action
+type apiMessageBody struct {
+	Message string
+	Steps   []string `json:",omitempty" description:"Progress of the long-running actions (e.g. pulling an image)"`
+}
+
+// Response of the routes that fail
+type apiErrorBody struct {
+	Error string
+	Steps []string `json:",omitempty" description:"Progress of the long-running actions, until they failed"`
+}
+
+// Response of GET /stacks/<name>
+type apiStackInspection struct {
+	Stack    resources.Stack
+	Services []resources.Container
+	Config   string `json:",omitempty" description:"Content of the docker-compose.yml file (on the local host only)"`
+}
+
+// Represent all the routes of the REST API
+var apiRoutes = []apiRoute{
+	// Containers
+	{
+		Method: http.MethodGet, Resource: "containers", Action: "containers.list",
+		Summary: "List the containers", Args: apiNoArgs{}, Response: resources.Containers{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return APIResponse{Status: http.StatusOK, Body: resources.ContainersList(client, filters.Args{})}
+		},
+	},
+	{
+		Method: http.MethodGet, Resource: "containers", Single: true, Action: "container.inspect.config", Revealable: true,
+		Summary: "Inspect a container, as docker inspect does (secrets redacted unless ?reveal=true)", Args: apiNoArgs{}, Response: ui.JSON{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			c, found := findContainer(client, request.ID)
+			if !found {
+				return apiNotFound("container", request.ID)
+			}
+
+			information, err := c.Inspect(client)
+			if err != nil {
+				return apiDockerError(err)
+			}
+
+			if rules, enabled := apiRedaction(request); enabled && information.Config != nil {
+				config := *information.Config
+				config.Env = rules.Env(config.Env)
+				information.Config = &config
+			}
+
+			return APIResponse{Status: http.StatusOK, Body: information}
+		},
+	},
+	pruneRoute("containers", "containers.prune", resources.ContainersPrune),
+	{
+		Method: http.MethodPost, Resource: "containers", Verb: "stop", Action: "containers.stop",
+		Summary: "Stop all the containers", Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return apiRunTask(client, resources.ContainersStop, nil, "All the containers were stopped")
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "containers", Verb: "restart", Action: "containers.restart",
+		Summary: "Restart all the containers", Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return apiRunTask(client, resources.ContainersRestart, nil, "All the containers were restarted")
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "containers", Verb: "update", Action: "containers.update",
+		Summary: "Update all the containers (pull their image, and recreate them)", Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return apiRunTask(client, resources.ContainersUpdate, nil, "All the containers were updated")
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "containers", Verb: "remove", Action: "containers.remove",
+		Summary: "Remove all the containers", Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			if err := resources.ContainersRemove(client); err != nil {
+				return apiDockerError(err)
+			}
+
+			return apiMessage("All the containers were removed")
+		},
+	},
+	containerRoute("pause", "container.pause", "Pause a container", apiNoArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if err := c.Pause(client); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully paused")
+	}),
+	containerRoute("unpause", "container.unpause", "Unpause a container", apiNoArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if err := c.Unpause(client); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully unpaused")
+	}),
+	containerRoute("stop", "container.stop", "Stop a container", apiNoArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if err := c.Stop(client); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully stopped")
+	}),
+	containerRoute("restart", "container.restart", "Restart a container", apiNoArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if err := c.Restart(client); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully restarted")
+	}),
+	containerRoute("update", "container.update", "Update a container (pull its image, and recreate it)", apiNoArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if err := c.Update(client); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully updated")
+	}),
+	containerRoute("rename", "container.rename", "Rename a container", apiRenameArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		var args apiRenameArgs
+		if err := apiArgs(request, &args); err != nil {
+			return apiError(http.StatusBadRequest, err)
+		}
+
+		if err := c.Rename(client, args.Name); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully renamed")
+	}),
+	containerRoute("remove", "container.remove", "Remove a container", apiContainerRemoveArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		var args apiContainerRemoveArgs
+		if err := apiArgs(request, &args); err != nil {
+			return apiError(http.StatusBadRequest, err)
+		}
+
+		if err := c.Remove(client, args.Force, args.RemoveVolumes); err != nil {
+			return apiDockerError(err)
+		}
+		return apiMessage("The container was succesfully removed")
+	}),
+	containerRoute("edit", "container.edit", "Edit a container (stop, remove, and run it again with a new run command)", apiRunCommandArgs{}, func(client *client.Client, c resources.Container, request APIRequest) APIResponse {
+		if response, ok := apiRequiresHostSystem(); !ok {
+			return response
+		}
+		if response, ok := apiRequiresLocalHost(client); !ok {
+			return response
+		}
+
+		var args apiRunCommandArgs
+		if err := apiArgs(request, &args); err != nil {
+			return apiError(http.StatusBadRequest, err)
+		}
+		if !strings.HasPrefix(args.Content, "docker run") {
+			return apiError(http.StatusBadRequest, fmt.Errorf("The new run command must start with \"docker run\" (Content)"))
+		}
+
+		return apiRunTask(client, c.Edit, ui.JSON{"Content": args.Content}, "The container was succesfully edited")
+	}),
+
+	// Images
+	{
+		Method: http.MethodGet, Resource: "images", Action: "images.list",
+		Summary: "List the images", Args: apiNoArgs{}, Response: resources.Images{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return APIResponse{Status: http.StatusOK, Body: resources.ImagesList(client)}
+		},
+	},
+	{
+		Method: http.MethodGet, Resource: "images", Single: true, Action: "image.inspect.config",
+		Summary: "Inspect an image, as docker inspect does", Args: apiNoArgs{}, Response: ui.JSON{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			i, found := findImage(client, request.ID)
+			if !found {
+				return apiNotFound("image", request.ID)
+			}
+
+			information, _, err := client.ImageInspectWithRaw(context.Background(), i.ID)
+			if err != nil {
+				return apiDockerError(err)
+			}
+
+			return APIResponse{Status: http.StatusOK, Body: information}
+		},
+	},
+	pruneRoute("images", "images.prune", resources.ImagesPrune),
+	{
+		Method: http.MethodPost, Resource: "images", Verb: "pull", Action: "image.pull",
+		Summary: "Pull an image", Args: apiPullArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			var args apiPullArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			return apiRunTask(client, resources.ImagePull, ui.JSON{"Image": args.Image}, fmt.Sprintf("The image %s was succesfully pulled", args.Image))
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "images", Single: true, Verb: "remove", Action: "image.remove",
+		Summary: "Remove an image", Args: apiImageRemoveArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			i, found := findImage(client, request.ID)
+			if !found {
+				return apiNotFound("image", request.ID)
+			}
+
+			var args apiImageRemoveArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			if err := i.Remove(client, args.Force, args.Prune); err != nil {
+				return apiDockerError(err)
+			}
+			return apiMessage("The image was succesfully removed")
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "images", Single: true, Verb: "run", Action: "image.run",
+		Summary: "Run a new container using an image", Args: apiImageRunArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			i, found := findImage(client, request.ID)
+			if !found {
+				return apiNotFound("image", request.ID)
+			}
+
+			var args apiImageRunArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			if err := i.Run(client, args.Name); err != nil {
+				return apiDockerError(err)
+			}
+			return APIResponse{Status: http.StatusCreated, Body: ui.JSON{"Message": "The image was succesfully used to run a new container"}}
+		},
+	},
+
+	// Volumes
+	{
+		Method: http.MethodGet, Resource: "volumes", Action: "volumes.list",
+		Summary: "List the volumes", Args: apiNoArgs{}, Response: resources.Volumes{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return APIResponse{Status: http.StatusOK, Body: resources.VolumesList(client)}
+		},
+	},
+	{
+		Method: http.MethodGet, Resource: "volumes", Single: true, Action: "volume.inspect.config",
+		Summary: "Inspect a volume, as docker inspect does", Args: apiNoArgs{}, Response: ui.JSON{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			information, err := client.VolumeInspect(context.Background(), request.ID)
+			if err != nil {
+				return apiDockerError(err)
+			}
+
+			return APIResponse{Status: http.StatusOK, Body: information}
+		},
+	},
+	pruneRoute("volumes", "volumes.prune", resources.VolumesPrune),
+	{
+		Method: http.MethodPost, Resource: "volumes", Single: true, Verb: "remove", Action: "volume.remove",
+		Summary: "Remove a volume", Args: apiVolumeRemoveArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			v, found := findVolume(client, request.ID)
+			if !found {
+				return apiNotFound("volume", request.ID)
+			}
+
+			var args apiVolumeRemoveArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			if err := v.Remove(client, args.Force); err != nil {
+				return apiDockerError(err)
+			}
+			return apiMessage("The volume was succesfully removed")
+		},
+	},
+
+	// Networks
+	{
+		Method: http.MethodGet, Resource: "networks", Action: "networks.list",
+		Summary: "List the networks", Args: apiNoArgs{}, Response: resources.Networks{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return APIResponse{Status: http.StatusOK, Body: resources.NetworksList(client)}
+		},
+	},
+	{
+		Method: http.MethodGet, Resource: "networks", Single: true, Action: "network.inspect.config",
+		Summary: "Inspect a network, as docker inspect does", Args: apiNoArgs{}, Response: ui.JSON{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			n, found := findNetwork(client, request.ID)
+			if !found {
+				return apiNotFound("network", request.ID)
+			}
+
+			information, err := client.NetworkInspect(context.Background(), n.ID, network.InspectOptions{})
+			if err != nil {
+				return apiDockerError(err)
+			}
+
+			return APIResponse{Status: http.StatusOK, Body: information}
+		},
+	},
+	pruneRoute("networks", "networks.prune", resources.NetworksPrune),
+	{
+		Method: http.MethodPost, Resource: "networks", Single: true, Verb: "remove", Action: "network.remove",
+		Summary: "Remove a network", Args: apiNoArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			n, found := findNetwork(client, request.ID)
+			if !found {
+				return apiNotFound("network", request.ID)
+			}
+
+			if err := n.Remove(client); err != nil {
+				return apiDockerError(err)
+			}
+			return apiMessage("The network was succesfully removed")
+		},
+	},
+
+	// Stacks
+	{
+		Method: http.MethodGet, Resource: "stacks", Action: "stacks.list",
+		Summary: "List the stacks", Args: apiNoArgs{}, Response: resources.Stacks{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			return APIResponse{Status: http.StatusOK, Body: resources.StacksList(client)}
+		},
+	},
+	{
+		Method: http.MethodGet, Resource: "stacks", Single: true, Action: "stack.inspect.config", Revealable: true,
+		Summary: "Inspect a stack, with its services and docker-compose.yml file (secrets redacted unless ?reveal=true)", Args: apiNoArgs{}, Response: apiStackInspection{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			s, found := findStack(client, request.ID)
+			if !found {
+				return apiNotFound("stack", request.ID)
+			}
+
+			body := apiStackInspection{
+				Stack:    s,
+				Services: resources.ContainersList(client, filters.NewArgs(filters.Arg("label", "com.docker.compose.project="+s.Name))),
+			}
+
+			// The docker-compose.yml file is readable only when it's on the same host as Isaiah
+			if _, ok := apiRequiresLocalHost(client); ok {
+				if config, err := os.ReadFile(s.ConfigFiles); err == nil {
+					body.Config = string(config)
+					if rules, enabled := apiRedaction(request); enabled {
+						body.Config = rules.Text(body.Config)
+					}
+				}
+			}
+
+			return APIResponse{Status: http.StatusOK, Body: body}
+		},
+	},
+	{
+		Method: http.MethodPost, Resource: "stacks", Verb: "create", Action: "stack.create",
+		Summary: "Create a new stack from a docker-compose.yml file", Args: apiComposeArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			if response, ok := apiRequiresLocalHost(client); !ok {
+				return response
+			}
+
+			var args apiComposeArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			response := apiRunTask(client, resources.StackCreate, ui.JSON{"Content": args.Content}, "The stack was succesfully created")
+			if response.Status == http.StatusOK {
+				response.Status = http.StatusCreated
+			}
+			return response
+		},
+	},
+	stacksRoute("update", "stacks.update", "Update all the stacks (pull their images, and recreate them)", resources.Stack.Update, "Your stacks were all succesfully updated"),
+	stacksRoute("restart", "stacks.restart", "Restart all the stacks", resources.Stack.Restart, "Your stacks were all succesfully restarted"),
+	stacksRoute("pause", "stacks.pause", "Pause all the stacks", resources.Stack.Pause, "Your stacks were all succesfully paused"),
+	stacksRoute("unpause", "stacks.unpause", "Unpause all the stacks", resources.Stack.Unpause, "Your stacks were all succesfully unpaused"),
+	stacksRoute("down", "stacks.down", "Stop and remove all the stacks", resources.Stack.Down, "Your stacks were all succesfully stopped and removed"),
+	stackRoute("up", "stack.up", "Start a stack", resources.Stack.Up, "The stack was succesfully started"),
+	stackRoute("down", "stack.down", "Stop and remove a stack", resources.Stack.Down, "The stack was succesfully stopped and removed"),
+	stackRoute("pause", "stack.pause", "Pause a stack", resources.Stack.Pause, "The stack was succesfully paused"),
+	stackRoute("unpause", "stack.unpause", "Unpause a stack", resources.Stack.Unpause, "The stack was succesfully unpaused"),
+	stackRoute("stop", "stack.stop", "Stop a stack", resources.Stack.Stop, "The stack was succesfully stopped"),
+	stackRoute("restart", "stack.restart", "Restart a stack", resources.Stack.Restart, "The stack was succesfully restarted"),
+	stackRoute("update", "stack.update", "Update a stack (pull its images, and recreate it)", resources.Stack.Update, "The stack was succesfully updated"),
+	{
+		Method: http.MethodPost, Resource: "stacks", Single: true, Verb: "edit", Action: "stack.edit",
+		Summary: "Edit a stack's docker-compose.yml file (down, overwrite, up)", Args: apiComposeArgs{}, Response: apiMessageBody{},
+		Run: func(client *client.Client, request APIRequest) APIResponse {
+			if response, ok := apiRequiresLocalHost(client); !ok {
+				return response
+			}
+
+			s, found := findStack(client, request.ID)
+			if !found {
+				return apiNotFound("stack", request.ID)
+			}
+
+			var args apiComposeArgs
+			if err := apiArgs(request, &args); err != nil {
+				return apiError(http.StatusBadRequest, err)
+			}
+
+			// Put back the sensitive values left redacted, as retrieved from GET /stacks/<name>
+			if strings.Contains(args.Content, redact.Mask) {
+				if original, err := s.GetRawConfig(client); err == nil {
+					args.Content = redact.Restore(args.Content, original)
+				}
+			}
+
+			return apiRunTask(client, s.Edit, ui.JSON{"Content": args.Content}, "The stack was succesfully edited (down, overwrite, up)")
+		},
+	},
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	"will-moss/isaiah/server/ui"
+)
+
+// Name of the file where API tokens are stored (hashed)
+const apiTokensFile = "api_tokens.json"
+
+// Prefix of every raw API token, to make them recognizable (e.g. by secret scanners)
+const apiTokenPrefix = "isaiah_"
+
+var (
+	ErrUnknownToken = errors.New("The API token is unknown or was revoked")
+	ErrExpiredToken = errors.New("The API token has expired")
+)
+
+// Represent a named API token, and the scopes it grants
+type APIToken struct {
+	Name    string
+	Hash    string   `json:",omitempty"` // sha256 digest of the raw token
+	Role    string   // Role granted, never higher than the creator's one
+	Actions []string // Allowed action prefixes (e.g. "stack.", "container.restart")
+	Hosts   []string // Allowed Docker hosts (all when empty)
+	Agents  []string // Allowed agents, "Master" referring to the Master node (all when empty)
+	Expires int64    // Unix timestamp after which the token is refused (never when zero)
+	Creator string
+	Created int64
+}
+
+// Represent the API tokens' state (tokens loaded from disk)
+type APITokens struct {
+	mutex  sync.Mutex
+	tokens []APIToken
+	loaded bool
+}
+
+// Compute the digest under which a raw token is stored
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lazily load the tokens stored on disk (must be called with the mutex held)
+func (t *APITokens) load() {
+	if t.loaded {
+		return
+	}
+	t.loaded = true
+	t.tokens = make([]APIToken, 0)
+
+	raw, err := os.ReadFile(apiTokensFile)
+	if err != nil {
+		return
+	}
+
+	if err := json.Unmarshal(raw, &t.tokens); err != nil {
+		log.Printf("Error loading the API tokens -> %s", err)
+	}
+}
+
+// Persist the tokens on disk (must be called with the mutex held)
+func (t *APITokens) save() error {
+	raw, err := json.MarshalIndent(t.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return _os.WriteFileAtomically(apiTokensFile, raw, 0600)
+}
+
+// Store a new token, and retrieve its raw value (shown only once)
+func (t *APITokens) Create(token APIToken) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	for _, existing := range t.tokens {
+		if existing.Name == token.Name {
+			return "", fmt.Errorf("An API token named %s already exists", token.Name)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	raw := apiTokenPrefix + hex.EncodeToString(secret)
+	token.Hash = hashAPIToken(raw)
+	token.Created = time.Now().Unix()
+
+	t.tokens = append(t.tokens, token)
+	if err := t.save(); err != nil {
+		t.tokens = t.tokens[:len(t.tokens)-1]
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// Remove the token with the given name, and persist the change
+func (t *APITokens) Revoke(name string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	index := slices.IndexFunc(t.tokens, func(token APIToken) bool { return token.Name == name })
+	if index == -1 {
+		return ErrUnknownToken
+	}
+
+	t.tokens = slices.Delete(t.tokens, index, index+1)
+	return t.save()
+}
+
+// Retrieve all the tokens, without their hashes
+func (t *APITokens) List() []APIToken {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	tokens := make([]APIToken, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		token.Hash = ""
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// Retrieve the token matching the given raw value, if valid
+func (t *APITokens) Verify(raw string) (APIToken, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	hashed := hashAPIToken(raw)
+	for _, token := range t.tokens {
+		if token.Hash != hashed {
+			continue
+		}
+
+		if token.Expires != 0 && time.Now().Unix() > token.Expires {
+			return token, ErrExpiredToken
+		}
+
+		return token, nil
+	}
+
+	return APIToken{}, ErrUnknownToken
+}
+
+// Retrieve the current state of the token with the given name, if still valid
+func (t *APITokens) find(name string) (APIToken, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	for _, token := range t.tokens {
+		if token.Name != name {
+			continue
+		}
+
+		if token.Expires != 0 && time.Now().Unix() > token.Expires {
+			return token, ErrExpiredToken
+		}
+
+		return token, nil
+	}
+
+	return APIToken{}, ErrUnknownToken
+}
+
+// Determine whether the token's scopes permit the given command, run on the given host
+func (token APIToken) Permits(command ui.Command, host string) bool {
+	if !slices.ContainsFunc(token.Actions, func(prefix string) bool { return strings.HasPrefix(command.Action, prefix) }) {
+		return false
+	}
+
+	if len(token.Hosts) > 0 && _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !slices.Contains(token.Hosts, host) {
+		return false
+	}
+
+	agent := command.Agent
+	if agent == "" {
+		agent = "Master"
+	}
+	if len(token.Agents) > 0 && !slices.Contains(token.Agents, agent) {
+		return false
+	}
+
+	return true
+}
+
+// Determine whether the session may run the given command, when it was authenticated by API token
+func (server *Server) isPermittedByToken(session _session.GenericSession, command ui.Command) bool {
+	// Logging in / out is always permitted (e.g. logging in on an agent, with one of its own tokens)
+	name, exists := session.Get("apiToken")
+	if !exists || command.Action == "auth.login" || command.Action == "auth.logout" {
+		return true
+	}
+
+	// Refuse as soon as the token is revoked or expired, even on already-open connections
+	token, err := server.APITokens.find(name.(string))
+	if err != nil {
+		return false
+	}
+
+	host := command.Host
+	if host == "" {
+		host, _ = server.CurrentHost()
+	}
+
+	return token.Permits(command, host)
+}
+
+// Authenticate the session using the given API token
+func (server *Server) authenticateWithToken(session _session.GenericSession, raw string) (APIToken, error) {
+	token, err := server.APITokens.Verify(raw)
+	if err != nil {
+		return token, err
+	}
+
+	session.Set("authenticated", true)
+	session.Set("role", token.Role)
+	session.Set("user", "token:"+token.Name)
+	session.Set("apiToken", token.Name)
+
+	return token, nil
+}
+
+// Retrieve the API token supplied in the request's Authorization header (Bearer scheme), if any
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	raw := strings.TrimSpace(header[7:])
+	return raw, strings.HasPrefix(raw, apiTokenPrefix)
+}
+
+// Authenticate a websocket connection (or any HTTP request) using the API token in its Authorization header
+func (server *Server) AuthenticateRequest(session _session.GenericSession, r *http.Request) (bool, error) {
+	raw, supplied := BearerToken(r)
+	if !supplied {
+		return false, nil
+	}
+
+	address := requestAddress(r)
+	if wait := server.Throttle.Wait(address); wait > 0 {
+		return true, fmt.Errorf("Too many failed attempts")
+	}
+
+	if _, err := server.authenticateWithToken(session, raw); err != nil {
+		server.Throttle.Fail(address)
+		log.Printf("Failed API token authentication from %s -> %s", address, err)
+		return true, err
+	}
+
+	server.Throttle.Succeed(address)
+	return true, nil
+}
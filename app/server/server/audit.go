@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	_json "will-moss/isaiah/server/_internal/json"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	_strconv "will-moss/isaiah/server/_internal/strconv"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Possible outcomes recorded for an audited command
+const (
+	OutcomeSuccess   = "success"
+	OutcomeError     = "error"
+	OutcomeForwarded = "forwarded" // The command was forwarded to an agent, which doesn't reply when it succeeds
+	OutcomeCompleted = "completed" // The command ran without reporting an explicit success / error
+)
+
+// Represent a single entry of the audit log
+type AuditRecord struct {
+	Time     string
+	Action   string
+	Resource string
+	Host     string
+	Agent    string
+	Session  string
+	User     string
+	Address  string
+	Outcome  string
+	Message  string
+	Previous string // sha256 digest of the previous line, chaining records to make tampering evident
+}
+
+// Represent the append-only audit log
+type AuditLog struct {
+	mutex    sync.Mutex
+	file     *os.File
+	previous string
+}
+
+// Placeholder used for internal organization
+type Auditing struct{}
+
+func (Auditing) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	switch command.Action {
+
+	// Command : List the audit records, most recent first
+	case "audit.list":
+		var filters AuditRecord
+		mapstructure.Decode(command.Args, &filters)
+
+		records, err := server.Audit.List(filters, auditLimit(command.Args))
+		if err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Audit": records}}))
+
+	// Command not found
+	default:
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("This command is unknown, unsupported, or not implemented yet : %s", command.Action),
+				},
+			}),
+		)
+	}
+}
+
+// Represent a session that keeps track of the notifications sent while running a command
+// Used only _internally to determine the outcome of an audited command
+type auditedSession struct {
+	_session.GenericSession
+	mutex   sync.Mutex
+	outcome string
+	message string
+}
+
+func (s *auditedSession) Write(message []byte) error {
+	// On agent nodes, notifications are wrapped inside an "agent.reply" command
+	var wrapped struct {
+		ui.Notification
+		Args struct{ Notification ui.Notification }
+	}
+
+	if err := json.Unmarshal(message, &wrapped); err == nil {
+		notification := wrapped.Notification
+		if notification.Type == "" {
+			notification = wrapped.Args.Notification
+		}
+
+		s.mutex.Lock()
+		switch notification.Type {
+		case ui.TypeError:
+			if s.outcome != OutcomeError {
+				s.outcome = OutcomeError
+				s.message, _ = notification.Content["Message"].(string)
+			}
+		case ui.TypeSuccess:
+			if s.outcome == "" && notification.Category == ui.CategoryReport {
+				s.outcome = OutcomeSuccess
+			}
+		}
+		s.mutex.Unlock()
+	}
+
+	return s.GenericSession.Write(message)
+}
+
+// Retrieve the outcome of the command, and the error message if any
+func (s *auditedSession) Result() (string, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.outcome == "" {
+		return OutcomeCompleted, ""
+	}
+
+	return s.outcome, s.message
+}
+
+// Retrieve the session that was wrapped
+func (s *auditedSession) Unwrap() _session.GenericSession {
+	return s.GenericSession
+}
+
+// Retrieve the audit log's file name
+func auditFile() string {
+	return _os.GetEnv("AUDIT_LOG_FILE")
+}
+
+// Lazily open the audit log file, and retrieve the digest of its last line (must be called with the mutex held)
+func (a *AuditLog) open() error {
+	if a.file != nil {
+		return nil
+	}
+
+	if raw, err := os.Open(auditFile()); err == nil {
+		scanner := bufio.NewScanner(raw)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				a.previous = digest(line)
+			}
+		}
+		raw.Close()
+	}
+
+	file, err := os.OpenFile(auditFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	a.file = file
+	return nil
+}
+
+// Append a record to the audit log
+func (a *AuditLog) Append(record AuditRecord) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := a.open(); err != nil {
+		log.Printf("Error opening the audit log -> %s", err)
+		return
+	}
+
+	record.Previous = a.previous
+	line := string(_json.Marshal(record))
+
+	if _, err := a.file.WriteString(line + "\n"); err != nil {
+		log.Printf("Error writing to the audit log -> %s", err)
+		return
+	}
+	a.file.Sync()
+
+	a.previous = digest(line)
+}
+
+// Retrieve the most recent records matching the given filters (latest first)
+func (a *AuditLog) List(filters AuditRecord, limit int) ([]AuditRecord, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	records := make([]AuditRecord, 0)
+
+	raw, err := os.Open(auditFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer raw.Close()
+
+	scanner := bufio.NewScanner(raw)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		if filters.Action != "" && !strings.HasPrefix(record.Action, filters.Action) {
+			continue
+		}
+		if filters.User != "" && record.User != filters.User {
+			continue
+		}
+		if filters.Resource != "" && !strings.Contains(record.Resource, filters.Resource) {
+			continue
+		}
+		if filters.Host != "" && record.Host != filters.Host {
+			continue
+		}
+		if filters.Agent != "" && record.Agent != filters.Agent {
+			continue
+		}
+		if filters.Outcome != "" && record.Outcome != filters.Outcome {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	// Keep only the most recent records, latest first
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, scanner.Err()
+}
+
+// Determine whether the given command should be audited (every mutating command, secrets' reveals, and agents' registration)
+func isAudited(action string) bool {
+	if _os.GetEnv("AUDIT_ENABLED") != "TRUE" {
+		return false
+	}
+
+	return IsMutating(action) || isRevealing(action) || action == "agent.register" || action == "host.add" || action == "host.remove"
+}
+
+// Create an audit record describing the given command, issued by the given session
+func newAuditRecord(session _session.GenericSession, command ui.Command) AuditRecord {
+	record := AuditRecord{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Action:  command.Action,
+		Host:    command.Host,
+		Agent:   command.Agent,
+		Address: sessionAddress(session),
+	}
+
+	if id, exists := session.Get("id"); exists {
+		record.Session = id.(string)
+	}
+	if _os.GetEnv("SERVER_ROLE") == "Agent" && command.Initiator != "" {
+		record.Session = command.Initiator
+	}
+	if user, exists := session.Get("user"); exists {
+		record.User = user.(string)
+	}
+
+	// Resource identity, as sent by the client (Name and / or ID)
+	var resource struct {
+		ID   string
+		Name string
+	}
+	mapstructure.Decode(command.Args["Resource"], &resource)
+
+	switch true {
+	case resource.Name != "" && resource.ID != "":
+		record.Resource = fmt.Sprintf("%s (%s)", resource.Name, resource.ID)
+	case resource.Name != "":
+		record.Resource = resource.Name
+	default:
+		record.Resource = resource.ID
+	}
+
+	return record
+}
+
+// Complete the record of a command forwarded to an agent, from the agent's first reply
+func (record *AuditRecord) completeWith(notification ui.Notification) {
+	switch {
+	case notification.Type == ui.TypeError:
+		record.Outcome = OutcomeError
+		record.Message, _ = notification.Content["Message"].(string)
+	case notification.Type == ui.TypeSuccess && notification.Category == ui.CategoryReport:
+		record.Outcome = OutcomeSuccess
+	default:
+		record.Outcome = OutcomeCompleted
+	}
+}
+
+// Parse the Limit argument of an audit.list command
+func auditLimit(args map[string]interface{}) int {
+	switch v := args["Limit"].(type) {
+	case float64:
+		return int(v)
+	case string:
+		return int(_strconv.ParseInt(v, 10, 64))
+	}
+
+	return 100
+}
+
+// Compute the sha256 hex digest of the given line
+func digest(line string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(line)))
+}
@@ -1,15 +1,36 @@
 package server
 
 import (
-	"crypto/sha256"
 	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 	_os "will-moss/isaiah/server/_internal/os"
+	_password "will-moss/isaiah/server/_internal/password"
 	_session "will-moss/isaiah/server/_internal/session"
+	"will-moss/isaiah/server/_internal/token"
+	"will-moss/isaiah/server/_internal/totp"
 	"will-moss/isaiah/server/ui"
+
+	"github.com/mitchellh/mapstructure"
 )
 
 type Authentication struct{}
 
+// Verify the given password against a raw secret, or a hash when provided
+func verifyPassword(password string, secret string, hash string) bool {
+	// Authentication against hashed password (bcrypt, argon2id, or sha256)
+	if hash != "" {
+		return _password.Verify(password, hash)
+	}
+
+	// Authentication against raw password
+	return password == secret
+}
+
 func (Authentication) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
 	switch command.Action {
 
@@ -17,6 +38,7 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 	case "auth.login":
 		if _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
 			session.Set("authenticated", true)
+			session.Set("role", RoleAdmin)
 			server.SendNotification(session, ui.NotificationAuth(ui.NP{
 				Type: ui.TypeSuccess,
 				Content: ui.JSON{
@@ -29,11 +51,32 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 			break
 		}
 
-		password := command.Args["Password"]
+		// API token : Used by automation clients, in place of the account's credentials
+		if raw, ok := command.Args["APIToken"].(string); ok {
+			address := sessionAddress(session)
+			if wait := server.Throttle.Wait(address); wait > 0 {
+				server.SendNotification(
+					session,
+					ui.NotificationAuth(ui.NP{
+						Type: ui.TypeError,
+						Content: ui.JSON{
+							"Authentication": ui.JSON{
+								"Message": fmt.Sprintf(
+									"Too many failed attempts. Please retry in %d seconds",
+									int(math.Ceil(wait.Seconds())),
+								),
+							},
+						},
+					}),
+				)
+				break
+			}
+
+			token, err := server.authenticateWithToken(session, raw)
+			if err != nil {
+				server.Throttle.Fail(address)
+				log.Printf("Failed API token authentication from %s -> %s", address, err)
 
-		// Authentication against raw password
-		if _os.GetEnv("AUTHENTICATION_HASH") == "" {
-			if password != _os.GetEnv("AUTHENTICATION_SECRET") {
 				session.Set("authenticated", false)
 				server.SendNotification(
 					session,
@@ -41,22 +84,136 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 						Type: ui.TypeError,
 						Content: ui.JSON{
 							"Authentication": ui.JSON{
-								"Message": "Invalid password",
+								"Message": err.Error(),
 							},
 						},
 					}),
 				)
 				break
 			}
+
+			server.Throttle.Succeed(address)
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeSuccess,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message":  "You are now authenticated",
+							"Seamless": true,
+							"Role":     token.Role,
+						},
+					},
+				}),
+			)
+			break
+		}
+
+		password, _ := command.Args["Password"].(string)
+		username, _ := command.Args["Username"].(string)
+
+		// Multi-user : The account must be identified before its password can be checked
+		if _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" && username == "" {
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeInfo,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message": "Please provide your username",
+							"Step":    "Username",
+						},
+					},
+				}),
+			)
+			break
+		}
+
+		// Brute-force protection : Refuse any attempt while the address is locked out / backing off
+		address, exempt := sessionAddress(session), isThrottlingExempt(session)
+		if wait := server.Throttle.Wait(address); wait > 0 && !exempt {
+			log.Printf("Refused authentication attempt from %s (too many failed attempts)", address)
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeError,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message": fmt.Sprintf(
+								"Too many failed attempts. Please retry in %d seconds",
+								int(math.Ceil(wait.Seconds())),
+							),
+						},
+					},
+				}),
+			)
+			break
+		}
+
+		// Default : Single account using the shared secret
+		role := RoleAdmin
+		secret := _os.GetEnv("AUTHENTICATION_SECRET")
+		hash := _os.GetEnv("AUTHENTICATION_HASH")
+
+		// Multi-user : Named account with its own password and role
+		var user User
+		if _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" {
+			var found bool
+			user, found = server.FindUser(username)
+			role, secret, hash = user.Role, user.Secret, user.Hash
+
+			if !found {
+				secret, hash = "", ""
+			}
+		}
+
+		if (secret == "" && hash == "") || !verifyPassword(password, secret, hash) {
+			if !exempt {
+				server.Throttle.Fail(address)
+			}
+			log.Printf("Failed authentication attempt from %s (account: %q)", address, username)
+
+			session.Set("authenticated", false)
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeError,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message": "Invalid password",
+						},
+					},
+				}),
+			)
+			break
 		}
 
-		// Authentication against hashed password
-		if _os.GetEnv("AUTHENTICATION_HASH") != "" {
-			hasher := sha256.New()
-			hasher.Write([]byte(password.(string)))
-			hashed := fmt.Sprintf("%x", hasher.Sum(nil))
+		// Two-factor : When enrolled, the account must also provide a TOTP code (or a recovery code)
+		if user.TOTPSecret != "" {
+			code, _ := command.Args["Code"].(string)
+
+			if code == "" {
+				server.SendNotification(
+					session,
+					ui.NotificationAuth(ui.NP{
+						Type: ui.TypeInfo,
+						Content: ui.JSON{
+							"Authentication": ui.JSON{
+								"Message": "Please provide your authentication code",
+								"Step":    "Code",
+							},
+						},
+					}),
+				)
+				break
+			}
+
+			if !server.verifySecondFactor(user, code) {
+				if !exempt {
+					server.Throttle.Fail(address)
+				}
+				log.Printf("Failed two-factor authentication attempt from %s (account: %q)", address, username)
 
-			if hashed != _os.GetEnv("AUTHENTICATION_HASH") {
 				session.Set("authenticated", false)
 				server.SendNotification(
 					session,
@@ -64,7 +221,7 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 						Type: ui.TypeError,
 						Content: ui.JSON{
 							"Authentication": ui.JSON{
-								"Message": "Invalid password",
+								"Message": "Invalid authentication code",
 							},
 						},
 					}),
@@ -73,30 +230,259 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 			}
 		}
 
-		session.Set("authenticated", true)
+		server.Throttle.Succeed(address)
 
-		showNothingOnFront, ok := command.Args["AutoLogin"]
+		showNothingOnFront, ok := command.Args["AutoLogin"].(bool)
 		if !ok {
 			showNothingOnFront = false
 		}
 
+		completeAuthentication(server, session, username, role, showNothingOnFront)
+
+	// Command : Authenticate the client by session token (issued on a prior login)
+	case "auth.resume":
+		if _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
+			completeAuthentication(server, session, "", RoleAdmin, true)
+			break
+		}
+
+		address := sessionAddress(session)
+		if wait := server.Throttle.Wait(address); wait > 0 {
+			log.Printf("Refused session token from %s (too many failed attempts)", address)
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeError,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message": fmt.Sprintf(
+								"Too many failed attempts. Please retry in %d seconds",
+								int(math.Ceil(wait.Seconds())),
+							),
+						},
+					},
+				}),
+			)
+			break
+		}
+
+		raw, _ := command.Args["Token"].(string)
+		claims, err := server.Tokens.Verify(raw)
+
+		// Multi-user : Ensure the account still exists, and use its current role
+		if err == nil && _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" {
+			user, found := server.FindUser(claims.User)
+			if !found {
+				err = fmt.Errorf("The account associated with the token doesn't exist anymore")
+			}
+			claims.Role = user.Role
+		}
+
+		if err != nil {
+			server.Throttle.Fail(address)
+			log.Printf("Failed session token authentication from %s -> %s", address, err)
+
+			session.Set("authenticated", false)
+			server.SendNotification(
+				session,
+				ui.NotificationAuth(ui.NP{
+					Type: ui.TypeError,
+					Content: ui.JSON{
+						"Authentication": ui.JSON{
+							"Message": "Your session has expired, please log in again",
+							"Expired": true,
+						},
+					},
+				}),
+			)
+			break
+		}
+
+		server.Throttle.Succeed(address)
+
+		// Keep using the same token, so it can be revoked on logout
+		session.Set("token", claims)
+		completeAuthentication(server, session, claims.User, claims.Role, true)
+
+	// Command : Log out the client, and revoke their session token
+	case "auth.logout":
+		if claims, exists := session.Get("token"); exists {
+			server.Tokens.Revoke(claims.(token.Claims).ID, claims.(token.Claims).Expires)
+			session.UnSet("token")
+		}
+
+		session.Set("authenticated", false)
+		session.UnSet("role")
+		session.UnSet("user")
+
+	// Command : Start the two-factor enrollment of the current account (secret, provisioning URI, recovery codes)
+	case "auth.totp.enroll":
+		user, ok := authenticatedUser(server, session)
+		if !ok {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "Two-factor authentication is only available to named accounts"}}))
+			break
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		codes, err := generateRecoveryCodes()
+		if err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		session.Set("totp", pendingEnrollment{Secret: secret, RecoveryCodes: codes})
+		uri := totp.ProvisioningURI("Isaiah", user.Name, secret)
+
 		server.SendNotification(
 			session,
-			ui.NotificationAuth(ui.NP{
-				Type: ui.TypeSuccess,
+			ui.NotificationPrompt(ui.NP{
 				Content: ui.JSON{
-					"Authentication": ui.JSON{
-						"Message":  "You are now authenticated",
-						"Seamless": showNothingOnFront,
+					"RunLocalCommand": true,
+					"Command":         "_confirmTwoFactor",
+					"Message": fmt.Sprintf(
+						"Add this account to your authenticator app, then confirm with a code."+
+							"<br /><br />Secret : %s<br />URI : %s<br /><br />Recovery codes (single-use, keep them safe) :<br />%s",
+						secret,
+						uri,
+						strings.Join(codes, "<br />"),
+					),
+					"Secret":        secret,
+					"URI":           uri,
+					"RecoveryCodes": codes,
+					"Input": ui.JSON{
+						"Name":        "Code",
+						"Type":        "input",
+						"Placeholder": "Please fill in the 6-digit code shown in your authenticator app",
 					},
-					"Preferences": server.GetPreferences(),
 				},
 			}),
 		)
 
-	// Command : Log out the client
-	case "auth.logout":
-		session.Set("authenticated", false)
+	// Command : Confirm the two-factor enrollment of the current account, using a first valid code
+	case "auth.totp.confirm":
+		user, ok := authenticatedUser(server, session)
+		if !ok {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "Two-factor authentication is only available to named accounts"}}))
+			break
+		}
+
+		pending, exists := session.Get("totp")
+		if !exists {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "No two-factor enrollment is in progress"}}))
+			break
+		}
+		enrollment := pending.(pendingEnrollment)
+
+		code, _ := command.Args["Code"].(string)
+		counter, valid := totp.Validate(enrollment.Secret, code, time.Now())
+		if !valid {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "Invalid authentication code, please retry the enrollment"}}))
+			break
+		}
+		server.TwoFactor.accept(user.Name, counter)
+
+		err := server.UpdateUser(user.Name, func(u *User) error {
+			u.TOTPSecret = enrollment.Secret
+			u.RecoveryCodes = make([]string, 0, len(enrollment.RecoveryCodes))
+			for _, c := range enrollment.RecoveryCodes {
+				u.RecoveryCodes = append(u.RecoveryCodes, hashRecoveryCode(c))
+			}
+			return nil
+		})
+		if err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+		session.UnSet("totp")
+
+		log.Printf("Two-factor authentication enrolled for account %q", user.Name)
+		server.SendNotification(session, ui.NotificationSuccess(ui.NP{
+			Content: ui.JSON{"Message": "Two-factor authentication is now enabled for your account"},
+		}))
+
+	// Command : Create a new API token, scoped to the given actions, hosts, and agents
+	case "auth.token.create":
+		if authenticated, _ := session.Get("authenticated"); authenticated != true {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "You are not authenticated yet"}}))
+			break
+		}
+
+		var args tokenCreateArgs
+		if err := mapstructure.Decode(command.Args, &args); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		if args.Name == "" || len(args.Actions) == 0 {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "An API token requires a Name, and at least one allowed action prefix in Actions"}}))
+			break
+		}
+
+		// The token can't grant more than its creator's role
+		role, _ := session.Get("role")
+		if args.Role == "" {
+			args.Role = role.(string)
+		}
+		if !slices.Contains(rolesHierarchy, args.Role) || !RoleSatisfies(role.(string), args.Role) {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("You can't grant the role %s to an API token", args.Role)}}))
+			break
+		}
+
+		creator := "admin"
+		if user, exists := session.Get("user"); exists {
+			creator = user.(string)
+		}
+
+		token := APIToken{
+			Name:    args.Name,
+			Role:    args.Role,
+			Actions: args.Actions,
+			Hosts:   args.Hosts,
+			Agents:  args.Agents,
+			Creator: creator,
+		}
+		if args.Lifetime > 0 {
+			token.Expires = time.Now().Add(time.Duration(args.Lifetime) * time.Second).Unix()
+		}
+
+		raw, err := server.APITokens.Create(token)
+		if err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		log.Printf("API token %s created by %s", token.Name, creator)
+		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"APIToken": ui.JSON{"Name": token.Name, "Token": raw}}}))
+
+	// Command : List the existing API tokens (without their secret values)
+	case "auth.token.list":
+		if authenticated, _ := session.Get("authenticated"); authenticated != true {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "You are not authenticated yet"}}))
+			break
+		}
+
+		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"APITokens": server.APITokens.List()}}))
+
+	// Command : Revoke an API token, effective immediately on open connections
+	case "auth.token.revoke":
+		if authenticated, _ := session.Get("authenticated"); authenticated != true {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "You are not authenticated yet"}}))
+			break
+		}
+
+		name, _ := command.Args["Name"].(string)
+		if err := server.APITokens.Revoke(name); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		log.Printf("API token %s revoked", name)
+		server.SendNotification(session, ui.NotificationSuccess(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("The API token %s was revoked", name)}}))
 
 	// Command not found
 	default:
@@ -113,3 +499,86 @@ func (Authentication) RunCommand(server *Server, session _session.GenericSession
 		)
 	}
 }
+
+// Retrieve the named account associated with an authenticated session (multi-user mode only)
+func authenticatedUser(server *Server, session _session.GenericSession) (User, bool) {
+	if authenticated, _ := session.Get("authenticated"); authenticated != true {
+		return User{}, false
+	}
+
+	if _os.GetEnv("MULTI_USER_ENABLED") != "TRUE" || _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
+		return User{}, false
+	}
+
+	name, exists := session.Get("user")
+	if !exists {
+		return User{}, false
+	}
+
+	return server.FindUser(name.(string))
+}
+
+// Mark the session as authenticated, and let the client know, along with a session token
+// when none was used to authenticate already
+func completeAuthentication(server *Server, session _session.GenericSession, user string, role string, seamless bool) {
+	session.Set("authenticated", true)
+	session.Set("role", role)
+	if user != "" {
+		session.Set("user", user)
+	}
+
+	details := ui.JSON{
+		"Message":  "You are now authenticated",
+		"Seamless": seamless,
+		"Role":     role,
+	}
+
+	if _os.GetEnv("AUTHENTICATION_ENABLED") == "TRUE" {
+		if _, exists := session.Get("token"); !exists {
+			raw, claims := server.Tokens.Issue(user, role)
+			session.Set("token", claims)
+			details["Token"] = raw
+		}
+	}
+
+	server.SendNotification(
+		session,
+		ui.NotificationAuth(ui.NP{
+			Type: ui.TypeSuccess,
+			Content: ui.JSON{
+				"Authentication": details,
+				"Preferences":    server.GetPreferences(),
+			},
+		}),
+	)
+}
+
+// Authenticate a websocket connection (or any HTTP request) using the Forward Proxy header, when enabled
+func (server *Server) AuthenticateForwardProxy(session _session.GenericSession, r *http.Request) bool {
+	if _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_ENABLED") != "TRUE" {
+		return false
+	}
+
+	requiredHeaderKey := _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_HEADER_KEY")
+	requiredHeaderValue := _os.GetEnv("FORWARD_PROXY_AUTHENTICATION_HEADER_VALUE")
+
+	suppliedHeaderValue := r.Header.Get(requiredHeaderKey)
+	if suppliedHeaderValue == "" || (requiredHeaderValue != "*" && suppliedHeaderValue != requiredHeaderValue) {
+		return false
+	}
+
+	// When multi-user is enabled, use the role of the account named after the header
+	role := RoleAdmin
+	if _os.GetEnv("MULTI_USER_ENABLED") == "TRUE" {
+		role = RoleViewer
+		if user, found := server.FindUser(suppliedHeaderValue); found {
+			role = user.Role
+		}
+		session.Set("user", suppliedHeaderValue)
+	}
+
+	session.Set("authenticated", true)
+	session.Set("role", role)
+
+	return true
+}
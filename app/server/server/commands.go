@@ -0,0 +1,391 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Represent a command that clients may send, and everything needed to run it
+type CommandDefinition struct {
+	Name     string
+	Args     interface{} // Structure the command's Args must fit (zero value), noArgs{} when none
+	Role     string      // Minimum role required to run the command
+	Mutating bool        // Whether the command modifies Docker resources, or runs anything on the hosting system
+	Silent   bool        // Whether the command doesn't reply when it succeeds (hence isn't awaited when forwarded to an agent)
+	Handler  handler     // nil for the commands run by the server itself (init, overview, shell, etc.)
+}
+
+// Arguments of the commands that don't take any
+type noArgs struct{}
+
+// Arguments of the commands that target a single resource (the row currently selected by the client)
+type resourceArgs struct {
+	Resource ui.JSON `required:"true"`
+}
+
+// Arguments of container.rename
+type renameArgs struct {
+	Resource ui.JSON `required:"true"`
+	Name     string  `required:"true"`
+}
+
+// Arguments of image.run
+type imageRunArgs struct {
+	Resource ui.JSON `required:"true"`
+	Name     string
+}
+
+// Arguments of container.edit and stack.edit
+type editArgs struct {
+	Resource ui.JSON `required:"true"`
+	Content  string  `required:"true"`
+}
+
+// Arguments of the inspector's Logs tab
+type logsArgs struct {
+	Resource       ui.JSON `required:"true"`
+	ShowTimestamps bool    `mapstructure:"showTimestamps"`
+}
+
+// Arguments of image.pull
+type pullArgs struct {
+	Image string `required:"true"`
+}
+
+// Arguments of stack.create
+type createStackArgs struct {
+	Content string `required:"true"`
+}
+
+// Arguments of shell.command
+type shellCommandArgs struct {
+	Command string `required:"true"`
+}
+
+// Arguments of auth.login
+type loginArgs struct {
+	APIToken  string
+	Password  string
+	Username  string
+	Code      string
+	AutoLogin bool
+}
+
+// Arguments of auth.resume
+type resumeArgs struct {
+	Token     string `required:"true"`
+	AutoLogin bool
+}
+
+// Arguments of auth.totp.confirm
+type codeArgs struct {
+	Code string `required:"true"`
+}
+
+// Arguments of auth.token.create
+type tokenCreateArgs struct {
+	Name     string
+	Role     string
+	Actions  []string
+	Hosts    []string
+	Agents   []string
+	Lifetime int64 // Seconds before expiration (never when zero)
+}
+
+// Arguments of auth.token.revoke
+type tokenRevokeArgs struct {
+	Name string `required:"true"`
+}
+
+// Arguments of agent.reply
+type agentReplyArgs struct {
+	To           string  `required:"true"`
+	Notification ui.JSON `required:"true"`
+}
+
+// Arguments of agent.pong (the heartbeat's emission time, as sent by Master, in Unix milliseconds)
+type agentPongArgs struct {
+	Sent int64 `required:"true"`
+}
+
+// Arguments of audit.list (filters, and number of records)
+type auditListArgs struct {
+	Action   string
+	Resource string
+	Host     string
+	Agent    string
+	User     string
+	Outcome  string
+	Limit    interface{}
+}
+
+// Arguments of host.add
+type hostAddArgs struct {
+	Name    string   `required:"true"`
+	Address string   `required:"true"`
+	Options []string // key=value transport options (ca, cert, key, identity, known_hosts, version)
+}
+
+// Arguments of host.remove
+type hostRemoveArgs struct {
+	Name string `required:"true"`
+}
+
+// Arguments of host.test (a known host's name, or any address)
+type hostTestArgs struct {
+	Name    string
+	Address string
+	Options []string // Used with Address only
+}
+
+// Arguments of the REST API calls forwarded by Master to agents (api.<action>)
+type apiForwardArgs struct {
+	Request ui.JSON `required:"true"`
+}
+
+// Represent all the commands that clients may send
+var commands = []CommandDefinition{
+	// Server
+	{Name: "init", Args: noArgs{}, Role: RoleViewer},
+	{Name: "enumerate", Args: noArgs{}, Role: RoleViewer},
+	{Name: "overview", Args: noArgs{}, Role: RoleViewer},
+	{Name: "clear", Args: noArgs{}, Role: RoleViewer, Silent: true},
+	{Name: "shell", Args: noArgs{}, Role: RoleAdmin, Mutating: true},
+	{Name: "shell.command", Args: shellCommandArgs{}, Role: RoleAdmin, Mutating: true, Silent: true},
+
+	// Authentication (available to everyone, except the management of API tokens)
+	{Name: "auth.login", Args: loginArgs{}, Role: RoleViewer, Handler: Authentication{}},
+	{Name: "auth.resume", Args: resumeArgs{}, Role: RoleViewer, Handler: Authentication{}},
+	{Name: "auth.logout", Args: noArgs{}, Role: RoleViewer, Silent: true, Handler: Authentication{}},
+	{Name: "auth.totp.enroll", Args: noArgs{}, Role: RoleViewer, Handler: Authentication{}},
+	{Name: "auth.totp.confirm", Args: codeArgs{}, Role: RoleViewer, Handler: Authentication{}},
+	{Name: "auth.token.create", Args: tokenCreateArgs{}, Role: RoleAdmin, Handler: Authentication{}},
+	{Name: "auth.token.list", Args: noArgs{}, Role: RoleAdmin, Handler: Authentication{}},
+	{Name: "auth.token.revoke", Args: tokenRevokeArgs{}, Role: RoleAdmin, Handler: Authentication{}},
+
+	// Agents, and audit log
+	{Name: "agent.register", Args: resourceArgs{}, Role: RoleAdmin, Handler: Agents{}},
+	{Name: "agent.reply", Args: agentReplyArgs{}, Role: RoleAdmin, Handler: Agents{}},
+	{Name: "agent.metrics", Args: noArgs{}, Role: RoleViewer, Handler: Agents{}},
+	{Name: "agent.pong", Args: agentPongArgs{}, Role: RoleAdmin, Handler: Agents{}},
+	{Name: "agent.status", Args: noArgs{}, Role: RoleViewer, Handler: Agents{}},
+	{Name: "audit.list", Args: auditListArgs{}, Role: RoleAdmin, Handler: Auditing{}},
+
+	// Hosts (multi-host)
+	{Name: "host.list", Args: noArgs{}, Role: RoleAdmin, Handler: Hosts{}},
+	{Name: "host.add", Args: hostAddArgs{}, Role: RoleAdmin, Handler: Hosts{}},
+	{Name: "host.remove", Args: hostRemoveArgs{}, Role: RoleAdmin, Handler: Hosts{}},
+	{Name: "host.test", Args: hostTestArgs{}, Role: RoleAdmin, Handler: Hosts{}},
+
+	// Containers
+	{Name: "container.menu", Args: noArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.menu.remove", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "containers.bulk", Args: noArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "containers.list", Args: noArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "containers.prune", Args: noArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "containers.stop", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "containers.update", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "containers.restart", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "containers.remove", Args: noArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.pause", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "container.stop", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "container.restart", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "container.remove.default", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.remove.force", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.remove.default.volumes", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.remove.force.volumes", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.shell", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.browser", Args: resourceArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.rename", Args: renameArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "container.update", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Containers{}},
+	{Name: "container.edit.prepare", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.edit", Args: editArgs{}, Role: RoleAdmin, Mutating: true, Handler: Containers{}},
+	{Name: "container.inspect.tabs", Args: noArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.inspect.logs", Args: logsArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.inspect.config", Args: resourceArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.inspect.config.reveal", Args: resourceArgs{}, Role: RoleAdmin, Handler: Containers{}},
+	{Name: "container.inspect.top", Args: resourceArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.inspect.env", Args: resourceArgs{}, Role: RoleViewer, Handler: Containers{}},
+	{Name: "container.inspect.env.reveal", Args: resourceArgs{}, Role: RoleAdmin, Handler: Containers{}},
+	{Name: "container.inspect.stats", Args: resourceArgs{}, Role: RoleViewer, Handler: Containers{}},
+
+	// Images
+	{Name: "image.menu", Args: noArgs{}, Role: RoleViewer, Handler: Images{}},
+	{Name: "image.menu.remove", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "images.bulk", Args: noArgs{}, Role: RoleViewer, Handler: Images{}},
+	{Name: "images.list", Args: noArgs{}, Role: RoleViewer, Handler: Images{}},
+	{Name: "images.prune", Args: noArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "images.pull", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Images{}},
+	{Name: "image.remove.default", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "image.remove.default.unprune", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "image.remove.force", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "image.remove.force.unprune", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Images{}},
+	{Name: "image.pull", Args: pullArgs{}, Role: RoleOperator, Mutating: true, Handler: Images{}},
+	{Name: "image.inspect.tabs", Args: noArgs{}, Role: RoleViewer, Handler: Images{}},
+	{Name: "image.inspect.config", Args: resourceArgs{}, Role: RoleViewer, Handler: Images{}},
+	{Name: "image.run", Args: imageRunArgs{}, Role: RoleOperator, Mutating: true, Handler: Images{}},
+
+	// Volumes
+	{Name: "volume.menu", Args: noArgs{}, Role: RoleViewer, Handler: Volumes{}},
+	{Name: "volume.menu.remove", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Volumes{}},
+	{Name: "volumes.bulk", Args: noArgs{}, Role: RoleViewer, Handler: Volumes{}},
+	{Name: "volumes.list", Args: noArgs{}, Role: RoleViewer, Handler: Volumes{}},
+	{Name: "volumes.prune", Args: noArgs{}, Role: RoleAdmin, Mutating: true, Handler: Volumes{}},
+	{Name: "volume.remove.default", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Volumes{}},
+	{Name: "volume.remove.force", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Volumes{}},
+	{Name: "volume.browse", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Volumes{}},
+	{Name: "volume.inspect.tabs", Args: noArgs{}, Role: RoleViewer, Handler: Volumes{}},
+	{Name: "volume.inspect.config", Args: resourceArgs{}, Role: RoleViewer, Handler: Volumes{}},
+
+	// Networks
+	{Name: "network.menu", Args: noArgs{}, Role: RoleViewer, Handler: Networks{}},
+	{Name: "network.menu.remove", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Networks{}},
+	{Name: "networks.bulk", Args: noArgs{}, Role: RoleViewer, Handler: Networks{}},
+	{Name: "networks.list", Args: noArgs{}, Role: RoleViewer, Handler: Networks{}},
+	{Name: "networks.prune", Args: noArgs{}, Role: RoleAdmin, Mutating: true, Handler: Networks{}},
+	{Name: "network.remove.default", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Networks{}},
+	{Name: "network.inspect.tabs", Args: noArgs{}, Role: RoleViewer, Handler: Networks{}},
+	{Name: "network.inspect.config", Args: resourceArgs{}, Role: RoleViewer, Handler: Networks{}},
+
+	// Stacks
+	{Name: "stack.menu", Args: noArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stacks.bulk", Args: noArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stacks.list", Args: noArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stacks.update", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stacks.restart", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stacks.pause", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stacks.unpause", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stacks.down", Args: noArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.up", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.pause", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.down", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.stop", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.update", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.restart", Args: resourceArgs{}, Role: RoleOperator, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.create", Args: createStackArgs{}, Role: RoleAdmin, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.edit.prepare", Args: resourceArgs{}, Role: RoleAdmin, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.edit", Args: editArgs{}, Role: RoleAdmin, Mutating: true, Handler: Stacks{}},
+	{Name: "stack.inspect.tabs", Args: noArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stack.inspect.services", Args: resourceArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stack.inspect.config", Args: resourceArgs{}, Role: RoleViewer, Handler: Stacks{}},
+	{Name: "stack.inspect.config.reveal", Args: resourceArgs{}, Role: RoleAdmin, Handler: Stacks{}},
+	{Name: "stack.inspect.logs", Args: logsArgs{}, Role: RoleViewer, Handler: Stacks{}},
+}
+
+// Retrieve the definition of the given command
+func FindCommand(action string) (CommandDefinition, bool) {
+	if index := slices.IndexFunc(commands, func(c CommandDefinition) bool { return c.Name == action }); index != -1 {
+		return commands[index], true
+	}
+
+	// Agent - REST API calls forwarded by Master, as api.<route's action>
+	if route, ok := strings.CutPrefix(action, "api."); ok && _os.GetEnv("SERVER_ROLE") == "Agent" {
+		route = strings.TrimSuffix(route, revealSuffix)
+		if slices.ContainsFunc(apiRoutes, func(r apiRoute) bool { return r.Action == route }) {
+			return CommandDefinition{
+				Name:     action,
+				Args:     apiForwardArgs{},
+				Role:     RequiredRole(action),
+				Mutating: IsMutating(action),
+				Handler:  API{},
+			}, true
+		}
+	}
+
+	return CommandDefinition{}, false
+}
+
+// Validate the given arguments against the given structure, and decode them into it
+// - Keys that don't match any field are refused, except "Resource" (clients attach their current selection to any command)
+// - Values must have the fields' types, and the fields tagged `required:"true"` must be supplied
+func decodeArgs(args ui.JSON, into interface{}) error {
+	value := reflect.ValueOf(into).Elem()
+
+	fields := make(map[string]bool)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		name := field.Tag.Get("mapstructure")
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+
+	for key := range args {
+		if !fields[strings.ToLower(key)] && key != "Resource" {
+			return fmt.Errorf("Unknown argument : %s", key)
+		}
+	}
+
+	if err := mapstructure.Decode(args, into); err != nil {
+		return fmt.Errorf("Malformed arguments -> %s", err)
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Tag.Get("required") == "true" && value.Field(i).IsZero() {
+			return fmt.Errorf("Missing argument : %s", field.Name)
+		}
+	}
+
+	return nil
+}
+
+// Ensure the given command is known, and that its arguments fit its definition
+// Returns the arguments rebuilt from their decoded structure : every declared field is present under its declared name
+// (whatever the case used by the client), with its declared type, so that handlers can read them without further checks
+func validateCommand(command ui.Command) (CommandDefinition, ui.JSON, error) {
+	definition, exists := FindCommand(command.Action)
+	if !exists {
+		return definition, nil, fmt.Errorf("This command is unknown, unsupported, or not implemented yet : %s", command.Action)
+	}
+
+	args := reflect.New(reflect.TypeOf(definition.Args)).Interface()
+	if err := decodeArgs(command.Args, args); err != nil {
+		return definition, nil, fmt.Errorf("Invalid arguments for %s -> %s", command.Action, err)
+	}
+
+	canonical := make(ui.JSON)
+	if err := mapstructure.Decode(args, &canonical); err != nil {
+		return definition, nil, fmt.Errorf("Invalid arguments for %s -> %s", command.Action, err)
+	}
+
+	// Clients attach their current selection to any command, keep it even when the command doesn't declare it
+	if _, declared := canonical["Resource"]; !declared {
+		if resource, exists := command.Args["Resource"]; exists {
+			canonical["Resource"] = resource
+		}
+	}
+
+	return definition, canonical, nil
+}
+
+// Ensure every command is fully declared
+// Used at startup, so that a command added without its Args / Role prevents Isaiah from starting
+func VerifyCommands() error {
+	seen := make(map[string]bool)
+
+	for _, c := range commands {
+		switch {
+		case c.Name == "":
+			return fmt.Errorf("A command is declared without a name")
+		case c.Args == nil || reflect.TypeOf(c.Args).Kind() != reflect.Struct:
+			return fmt.Errorf("%s -> Args must be declared as a structure (noArgs{} when none)", c.Name)
+		case !slices.Contains(rolesHierarchy, c.Role):
+			return fmt.Errorf("%s -> Role is invalid : %s", c.Name, c.Role)
+		case seen[c.Name]:
+			return fmt.Errorf("%s -> Command is declared twice", c.Name)
+		}
+
+		seen[c.Name] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	_client "will-moss/isaiah/server/_internal/client"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/docker/docker/client"
+)
+
+// Session recording the notifications written to it
+type testSession struct {
+	mutex    sync.Mutex
+	keys     map[string]interface{}
+	messages []string
+}
+
+func newTestSession() *testSession {
+	return &testSession{keys: map[string]interface{}{"id": "test", "authenticated": true, "role": RoleAdmin}}
+}
+
+func (s *testSession) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key] = value
+}
+
+func (s *testSession) Get(key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, exists := s.keys[key]
+	return value, exists
+}
+
+func (s *testSession) UnSet(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.keys, key)
+}
+
+func (s *testSession) Write(message []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.messages = append(s.messages, string(message))
+	return nil
+}
+
+// Server whose Docker host doesn't exist, so that handlers fail gracefully rather than reaching a real daemon
+func newTestServer() *Server {
+	return &Server{Docker: _client.NewClientWithOpts(client.WithHost("unix:///nonexistent/docker.sock"))}
+}
+
+// Arguments that pass validation must never make a handler panic (missing optional fields, keys in another case)
+func TestValidatedArgumentsDontPanic(t *testing.T) {
+	resource := ui.JSON{"ID": "abc", "Name": "abc"}
+
+	cases := []struct {
+		action  string
+		args    ui.JSON
+		handler handler
+	}{
+		{"container.inspect.logs", ui.JSON{"Resource": resource}, Containers{}},
+		{"container.inspect.logs", ui.JSON{"Resource": resource, "showtimestamps": true}, Containers{}},
+		{"container.rename", ui.JSON{"Resource": resource, "name": "renamed"}, Containers{}},
+		{"stack.inspect.logs", ui.JSON{"Resource": resource, "showtimestamps": true}, Stacks{}},
+		{"stack.inspect.logs", ui.JSON{"Resource": resource}, Stacks{}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%s %v", c.action, c.args), func(t *testing.T) {
+			command := ui.Command{Action: c.action, Args: c.args}
+
+			_, args, err := validateCommand(command)
+			if err != nil {
+				t.Fatalf("Expected the arguments to be valid, got : %s", err)
+			}
+			command.Args = args
+
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("The handler panicked : %v", r)
+				}
+			}()
+
+			c.handler.RunCommand(newTestServer(), newTestSession(), command)
+		})
+	}
+}
+
+// Arguments that don't fit the command's definition are refused before reaching any handler
+func TestInvalidArgumentsAreRefused(t *testing.T) {
+	cases := []ui.Command{
+		{Action: "container.rename", Args: ui.JSON{"Resource": ui.JSON{"ID": "abc"}}},
+		{Action: "container.rename", Args: ui.JSON{"Resource": ui.JSON{"ID": "abc"}, "Name": 42}},
+		{Action: "container.inspect.logs", Args: ui.JSON{"Resource": ui.JSON{"ID": "abc"}, "showTimestamps": "yes"}},
+		{Action: "container.inspect.logs", Args: ui.JSON{"Resource": ui.JSON{"ID": "abc"}, "Unknown": true}},
+		{Action: "unknown.command"},
+	}
+
+	for _, command := range cases {
+		if _, _, err := validateCommand(command); err == nil {
+			t.Errorf("Expected %s %v to be refused", command.Action, command.Args)
+		}
+	}
+}
+
+// Validated arguments are exposed under their declared name, with their declared type
+func TestValidatedArgumentsAreCanonical(t *testing.T) {
+	_, args, err := validateCommand(ui.Command{Action: "container.rename", Args: ui.JSON{"resource": ui.JSON{"ID": "abc"}, "NAME": "renamed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, ok := args["Name"].(string); !ok || name != "renamed" {
+		t.Errorf("Expected Name to be \"renamed\", got %v", args["Name"])
+	}
+
+	_, args, err = validateCommand(ui.Command{Action: "container.inspect.logs", Args: ui.JSON{"Resource": ui.JSON{"ID": "abc"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, ok := args["showTimestamps"].(bool); !ok || value {
+		t.Errorf("Expected showTimestamps to default to false, got %v", args["showTimestamps"])
+	}
+}
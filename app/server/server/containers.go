@@ -7,6 +7,7 @@ import (
 	_io "will-moss/isaiah/server/_internal/io"
 	_os "will-moss/isaiah/server/_internal/os"
 	"will-moss/isaiah/server/_internal/process"
+	"will-moss/isaiah/server/_internal/redact"
 	_session "will-moss/isaiah/server/_internal/session"
 	_slices "will-moss/isaiah/server/_internal/slices"
 	_strconv "will-moss/isaiah/server/_internal/strconv"
@@ -22,11 +23,13 @@ import (
 type Containers struct{}
 
 func (Containers) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	switch command.Action {
 
 	// Single - Default menu
 	case "container.menu":
-		actions := resources.ContainerSingleActions()
+		actions := server.allowedActions(session, resources.ContainerSingleActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Single - Remove menu
@@ -34,18 +37,18 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		actions := resources.ContainerRemoveActions(container)
+		actions := server.allowedActions(session, resources.ContainerRemoveActions(container))
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - Bulk menu
 	case "containers.bulk":
-		actions := resources.ContainersBulkActions()
+		actions := server.allowedActions(session, resources.ContainersBulkActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - List
 	case "containers.list":
 		columns := strings.Split(_os.GetEnv("COLUMNS_CONTAINERS"), ",")
-		containers := resources.ContainersList(server.Docker, filters.Args{})
+		containers := resources.ContainersList(docker, filters.Args{})
 
 		rows := containers.ToRows(columns)
 
@@ -77,7 +80,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 	// Bulk - Prune
 	case "containers.prune":
-		err := resources.ContainersPrune(server.Docker)
+		err := resources.ContainersPrune(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -118,7 +121,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Bulk - Update
 	case "containers.update":
@@ -149,7 +152,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Bulk - Restart
 	case "containers.restart":
@@ -180,11 +183,11 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Bulk - Remove
 	case "containers.remove":
-		err := resources.ContainersRemove(server.Docker)
+		err := resources.ContainersRemove(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -201,7 +204,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		information, err := container.Inspect(server.Docker)
+		information, err := container.Inspect(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -209,10 +212,10 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 		var newState string
 		if information.State.Paused {
-			err = container.Unpause(server.Docker)
+			err = container.Unpause(docker)
 			newState = "unpaused"
 		} else {
-			err = container.Pause(server.Docker)
+			err = container.Pause(docker)
 			newState = "paused"
 		}
 
@@ -232,7 +235,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		err := container.Stop(server.Docker)
+		err := container.Stop(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -250,7 +253,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		err := container.Restart(server.Docker)
+		err := container.Restart(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -267,7 +270,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		information, err := container.Inspect(server.Docker)
+		information, err := container.Inspect(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -287,7 +290,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
-		err = container.Remove(server.Docker, false, false)
+		err = container.Remove(docker, false, false)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -305,7 +308,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		err := container.Remove(server.Docker, true, false)
+		err := container.Remove(docker, true, false)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -323,7 +326,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		information, err := container.Inspect(server.Docker)
+		information, err := container.Inspect(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -343,7 +346,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
-		err = container.Remove(server.Docker, false, true)
+		err = container.Remove(docker, false, true)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -361,7 +364,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		err := container.Remove(server.Docker, true, true)
+		err := container.Remove(docker, true, true)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -389,7 +392,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 		go func() {
 			errs, updates, finished := make(chan error), make(chan string), false
-			go container.Shell(server.Docker, &terminal, errs, updates)
+			go container.Shell(docker, &terminal, errs, updates)
 
 			for {
 				if finished {
@@ -411,7 +414,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 	case "container.browser":
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
-		address, err := container.GetBrowserUrl(server.Docker)
+		address, err := container.GetBrowserUrl(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -422,9 +425,12 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 	// Single - Rename
 	case "container.rename":
+		var args renameArgs
+		mapstructure.Decode(command.Args, &args)
+
 		var container resources.Container
-		mapstructure.Decode(command.Args["Resource"], &container)
-		err := container.Rename(server.Docker, command.Args["Name"].(string))
+		mapstructure.Decode(args.Resource, &container)
+		err := container.Rename(docker, args.Name)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -457,7 +463,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
-		err := container.Update(server.Docker)
+		err := container.Update(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -487,7 +493,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -504,13 +510,18 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
-		_command, err := container.GetRunCommand(server.Docker)
+		_command, err := container.GetRunCommand(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
 		}
 
+		// Hide the sensitive values, they're put back when the edited command is submitted
+		if rules, enabled := redactionRules(command.Action); enabled {
+			_command = rules.Text(_command)
+		}
+
 		server.SendNotification(
 			session,
 			ui.NotificationPrompt(ui.NP{
@@ -543,7 +554,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -561,7 +572,10 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		newCommand := command.Args["Content"].(string)
+		var args editArgs
+		mapstructure.Decode(command.Args, &args)
+
+		newCommand := args.Content
 		if !strings.HasPrefix(newCommand, "docker run") {
 			server.SendNotification(
 				session,
@@ -575,6 +589,13 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 			break
 		}
 
+		// Put back the sensitive values that were redacted when the command was prepared
+		if strings.Contains(newCommand, redact.Mask) {
+			if original, err := container.GetRunCommand(docker); err == nil {
+				command.Args["Content"] = redact.Restore(newCommand, original)
+			}
+		}
+
 		task := process.LongTask{
 			Function: container.Edit,
 			Args:     command.Args, // Expects : { "Content": <string> }
@@ -605,7 +626,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Single - Get inspector tabs
 	case "container.inspect.tabs":
@@ -618,12 +639,15 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 
 	// Single - Inspect logs
 	case "container.inspect.logs":
-		var showTimestamps = command.Args["showTimestamps"].(bool)
+		var args logsArgs
+		mapstructure.Decode(command.Args, &args)
+
+		var showTimestamps = args.ShowTimestamps
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
 		stream, err := container.GetLogs(
-			server.Docker,
+			docker,
 			_io.CustomWriter{WriteFunction: func(p []byte) {
 				server.SendNotification(
 					session,
@@ -658,16 +682,20 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		)
 
 	// Single - Inspect full configuration
-	case "container.inspect.config":
+	case "container.inspect.config", "container.inspect.config.reveal":
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
-		config, err := container.GetConfig(server.Docker)
+		config, err := container.GetConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
 		}
 
+		if rules, enabled := redactionRules(command.Action); enabled {
+			config = redactInspector(rules, config)
+		}
+
 		server.SendNotification(
 			session,
 			ui.NotificationData(ui.NP{
@@ -684,7 +712,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
 
-		processes, err := container.GetTop(server.Docker)
+		processes, err := container.GetTop(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -704,16 +732,20 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 		)
 
 	// Single - Inspect environment variables
-	case "container.inspect.env":
+	case "container.inspect.env", "container.inspect.env.reveal":
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
-		env, err := container.GetEnv(server.Docker)
+		env, err := container.GetEnv(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
 		}
 
+		if rules, enabled := redactionRules(command.Action); enabled {
+			env = redactRows(rules, env)
+		}
+
 		server.SendNotification(
 			session,
 			ui.NotificationData(ui.NP{
@@ -731,7 +763,7 @@ func (Containers) RunCommand(server *Server, session _session.GenericSession, co
 	case "container.inspect.stats":
 		var container resources.Container
 		mapstructure.Decode(command.Args["Resource"], &container)
-		stats, err := container.GetStats(server.Docker)
+		stats, err := container.GetStats(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+
+	"github.com/docker/docker/client"
+)
+
+// Maximum duration of every check performed by the health and readiness endpoints
+const healthCheckTimeout = 5 * time.Second
+
+// Health statuses, from best to worst
+const (
+	HealthOK          = "ok"          // Every check passed
+	HealthDegraded    = "degraded"    // Isaiah works, but some features are unavailable (e.g. Stacks without compose)
+	HealthUnavailable = "unavailable" // Isaiah can't serve its clients (e.g. a Docker host doesn't answer)
+)
+
+// Duration during which a health report is reused, so that frequent probes don't hammer the Docker hosts
+const healthCacheDuration = 5 * time.Second
+
+// Moment the process started, reported as uptime
+var startedAt = time.Now()
+
+// Most recent health report, shared by both endpoints
+var healthCache struct {
+	mutex     sync.Mutex
+	report    HealthReport
+	checkedAt time.Time
+}
+
+// Represent the outcome of checking a single dependency
+type HealthCheck struct {
+	Available bool
+	Version   string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+// Represent the outcome of checking a single Docker host
+type HealthHost struct {
+	Name       string
+	Reachable  bool
+	Version    string `json:",omitempty"`
+	APIVersion string `json:",omitempty"`
+	LatencyMs  int64
+	Error      string `json:",omitempty"`
+}
+
+// Represent the full health report of the node, as served by /healthz and /readyz
+type HealthReport struct {
+	Status    string
+	Ready     bool
+	Role      string
+	Uptime    int64 // Seconds
+	Hosts     []HealthHost
+	DockerCLI HealthCheck
+	Compose   HealthCheck
+	Agents    struct {
+		Count  int
+		Names  []string
+		Status map[string]AgentStatus
+	}
+}
+
+// Run the given command with a timeout, and retrieve its trimmed output
+func runHealthCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Check whether the given Docker host answers, and how fast
+func checkDockerHost(name string, client *client.Client) HealthHost {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	host := HealthHost{Name: name}
+
+	start := time.Now()
+	version, err := client.ServerVersion(ctx)
+	host.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		host.Error = err.Error()
+		return host
+	}
+
+	host.Reachable = true
+	host.Version = version.Version
+	host.APIVersion = version.APIVersion
+
+	return host
+}
+
+// Check every dependency of the node, in parallel
+func (server *Server) HealthReport() HealthReport {
+	report := HealthReport{Role: _os.GetEnv("SERVER_ROLE"), Uptime: int64(time.Since(startedAt).Seconds())}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	// Docker hosts
+	checkHost := func(name string, definition []string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var host HealthHost
+			if definition == nil {
+				host = checkDockerHost(name, server.Docker)
+			} else if c, err := server.Clients.Get(definition); err != nil {
+				host = HealthHost{Name: name, Error: err.Error()}
+			} else {
+				host = checkDockerHost(name, c)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Hosts = append(report.Hosts, host)
+		}()
+	}
+
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
+		for _, h := range server.KnownHosts() {
+			checkHost(h[0], h)
+		}
+	} else {
+		checkHost("local", nil)
+	}
+
+	// Docker CLI and compose plugin, used by shells, stacks, and updates
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if version, err := runHealthCommand("docker", "version", "--format", "{{.Client.Version}}"); err != nil {
+			report.DockerCLI.Error = err.Error()
+		} else {
+			report.DockerCLI = HealthCheck{Available: true, Version: version}
+		}
+
+		if version, err := runHealthCommand("docker", "compose", "version", "--short"); err != nil {
+			report.Compose.Error = err.Error()
+		} else {
+			report.Compose = HealthCheck{Available: true, Version: version}
+		}
+	}()
+
+	wg.Wait()
+
+	// Agents
+	report.Agents.Names = server.KnownAgents().ToStrings()
+	report.Agents.Count = len(report.Agents.Names)
+	report.Agents.Status = server.Heartbeats.Status(report.Agents.Names)
+
+	// Keep the hosts in the order they're declared
+	order := server.KnownHosts().ToStrings()
+	slices.SortFunc(report.Hosts, func(a, b HealthHost) int {
+		return slices.Index(order, a.Name) - slices.Index(order, b.Name)
+	})
+
+	// Overall status : Every host and the Docker CLI are required, compose only when the Stacks tab is enabled
+	report.Status = HealthOK
+	report.Ready = true
+
+	stacksEnabled := slices.Contains(strings.Split(_os.GetEnv("TABS_ENABLED"), ","), "Stacks")
+	if !report.Compose.Available && stacksEnabled {
+		report.Status = HealthDegraded
+	}
+
+	if !report.DockerCLI.Available || slices.ContainsFunc(report.Hosts, func(h HealthHost) bool { return !h.Reachable }) {
+		report.Status = HealthUnavailable
+		report.Ready = false
+	}
+
+	return report
+}
+
+// Retrieve the most recent health report, checking again when it's outdated
+func (server *Server) cachedHealthReport() HealthReport {
+	healthCache.mutex.Lock()
+	defer healthCache.mutex.Unlock()
+
+	if time.Since(healthCache.checkedAt) > healthCacheDuration {
+		healthCache.report = server.HealthReport()
+		healthCache.checkedAt = time.Now()
+	}
+
+	return healthCache.report
+}
+
+// HTTP - Liveness probe : Answers 200 as long as Isaiah serves requests, along with the details of every check
+func (server *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeAPIResponse(w, APIResponse{Status: http.StatusOK, Body: server.cachedHealthReport()})
+}
+
+// HTTP - Readiness probe : Answers 503 when Isaiah can't serve its clients (a Docker host or the Docker CLI is unavailable)
+func (server *Server) HandleReady(w http.ResponseWriter, r *http.Request) {
+	report := server.cachedHealthReport()
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeAPIResponse(w, APIResponse{Status: status, Body: report})
+}
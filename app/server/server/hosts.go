@@ -1,8 +1,56 @@
 package server
 
-// Represent an array of Isaiah hosts ([name, hostname])
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	"will-moss/isaiah/server/ui"
+
+	_client "will-moss/isaiah/server/_internal/client"
+
+	"github.com/docker/docker/client"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Name of the file listing the Docker hosts, when multi-host is enabled
+const HostsFile = "docker_hosts"
+
+// Interval between two checks of the hosts file for changes
+const hostsWatchInterval = 5 * time.Second
+
+// Interval between two checks of the hosts' reachability
+const hostsCheckInterval = 30 * time.Second
+
+// Delay before closing the client of a host that was edited or removed, while it may still be in use
+const retiredClientsGrace = 10 * time.Minute
+
+// Schemes accepted in a host's address
+var hostsSchemes = []string{"unix://", "tcp://", "ssh://", "npipe://", "http://", "https://"}
+
+// Transport options accepted after a host's address, as key=value
+var hostsOptions = []string{"ca", "cert", "key", "identity", "known_hosts", "version"}
+
+// Represent an array of Isaiah hosts ([name, hostname, options...])
 type HostsArray [][]string
 
+// Represent a pool of long-lived Docker clients, one per host, safe for concurrent use
+type DockerClients struct {
+	mutex   sync.Mutex
+	clients map[string]pooledClient
+}
+
+type pooledClient struct {
+	definition string
+	client     *client.Client
+}
+
 func (hosts HostsArray) ToStrings() []string {
 	arr := make([]string, 0)
 
@@ -12,3 +60,565 @@ func (hosts HostsArray) ToStrings() []string {
 
 	return arr
 }
+
+// Retrieve the address of the host with the given name
+func (hosts HostsArray) Address(name string) (string, bool) {
+	index := slices.IndexFunc(hosts, func(h []string) bool { return h[0] == name })
+	if index == -1 {
+		return "", false
+	}
+
+	return hosts[index][1], true
+}
+
+// Retrieve the full definition of the host with the given name
+func (hosts HostsArray) Find(name string) ([]string, bool) {
+	index := slices.IndexFunc(hosts, func(h []string) bool { return h[0] == name })
+	if index == -1 {
+		return nil, false
+	}
+
+	return hosts[index], true
+}
+
+// Parse the transport options of a host (key=value), ensuring they fit its address
+func parseHostOptions(address string, options []string) (_client.HostOptions, error) {
+	var parsed _client.HostOptions
+
+	isSSH := strings.HasPrefix(address, "ssh://")
+	isTCP := strings.HasPrefix(address, "tcp://") || strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://")
+
+	for _, option := range options {
+		key, value, found := strings.Cut(option, "=")
+		if !found || value == "" || !slices.Contains(hostsOptions, key) {
+			return parsed, fmt.Errorf("The option %s must be formatted as key=value, with key one of : %s", option, strings.Join(hostsOptions, ", "))
+		}
+
+		switch key {
+		case "ca", "cert", "key":
+			if !isTCP {
+				return parsed, fmt.Errorf("The option %s is available only for tcp:// and http(s):// addresses", key)
+			}
+		case "identity", "known_hosts":
+			if !isSSH {
+				return parsed, fmt.Errorf("The option %s is available only for ssh:// addresses", key)
+			}
+		}
+
+		switch key {
+		case "ca":
+			parsed.CA = value
+		case "cert":
+			parsed.Cert = value
+		case "key":
+			parsed.Key = value
+		case "identity":
+			parsed.Identity = value
+		case "known_hosts":
+			parsed.KnownHosts = value
+		case "version":
+			parsed.Version = value
+		}
+	}
+
+	if (parsed.Cert == "") != (parsed.Key == "") {
+		return parsed, fmt.Errorf("The options cert and key must be supplied together")
+	}
+
+	return parsed, nil
+}
+
+// Ensure a host can be added to the given ones
+func validateHost(name string, address string, options []string, hosts HostsArray) error {
+	if name == "" || strings.ContainsAny(name, " \t#") {
+		return fmt.Errorf("The host's name can't be empty, nor contain spaces or #")
+	}
+	if !slices.ContainsFunc(hostsSchemes, func(scheme string) bool { return strings.HasPrefix(address, scheme) }) {
+		return fmt.Errorf("The address of %s must start with one of : %s", name, strings.Join(hostsSchemes, ", "))
+	}
+	if _, exists := hosts.Address(name); exists {
+		return fmt.Errorf("The host %s is declared twice", name)
+	}
+	if _, err := parseHostOptions(address, options); err != nil {
+		return fmt.Errorf("%s -> %s", name, err)
+	}
+
+	return nil
+}
+
+// Parse the content of a hosts file : one "<name> <address> [key=value ...]" per line, blank lines and # comments being ignored
+func ParseHosts(raw string) (HostsArray, error) {
+	hosts := make(HostsArray, 0)
+
+	for index, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Line %d isn't formatted as \"<name> <address> [key=value ...]\" -> %s", index+1, line)
+		}
+
+		if err := validateHost(parts[0], parts[1], parts[2:], hosts); err != nil {
+			return nil, fmt.Errorf("Line %d -> %s", index+1, err)
+		}
+
+		hosts = append(hosts, parts)
+	}
+
+	if len(hosts) == 0 {
+		return nil, errors.New("No host is declared")
+	}
+
+	return hosts, nil
+}
+
+// Load the hosts declared in the given file
+func LoadHosts(path string) (HostsArray, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHosts(string(raw))
+}
+
+// Render the hosts in the hosts file's format
+func (hosts HostsArray) String() string {
+	var builder strings.Builder
+	for _, h := range hosts {
+		fmt.Fprintln(&builder, strings.Join(h, " "))
+	}
+
+	return builder.String()
+}
+
+// Create a client for the given host definition ([name, address, options...])
+func newHostClient(host []string) (*client.Client, error) {
+	options, err := parseHostOptions(host[1], host[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return _client.NewHostClient(host[1], options)
+}
+
+// Retrieve the client of the given host, creating it on first use (or when the host's definition changed)
+func (p *DockerClients) Get(host []string) (*client.Client, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.clients == nil {
+		p.clients = make(map[string]pooledClient)
+	}
+
+	definition := strings.Join(host, " ")
+	if pooled, exists := p.clients[host[0]]; exists {
+		if pooled.definition == definition {
+			return pooled.client, nil
+		}
+		retire(pooled.client)
+		delete(p.clients, host[0])
+	}
+
+	c, err := newHostClient(host)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[host[0]] = pooledClient{definition: definition, client: c}
+
+	return c, nil
+}
+
+// Forget the client of the given host, and close it once its current users are done
+func (p *DockerClients) Forget(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if pooled, exists := p.clients[name]; exists {
+		retire(pooled.client)
+		delete(p.clients, name)
+	}
+}
+
+// Close a client that's no longer handed out, after a grace period letting its current users finish
+// (commands, and streams such as logs and shells, obtained it before it was replaced or forgotten)
+func retire(c *client.Client) {
+	time.AfterFunc(retiredClientsGrace, func() { _client.Close(c) })
+}
+
+// Retrieve the Docker client of the given host when multi-host is enabled, or the only one otherwise
+func (s *Server) HostClient(name string) (*client.Client, error) {
+	if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" {
+		return s.Docker, nil
+	}
+
+	host, exists := s.KnownHosts().Find(name)
+	if !exists {
+		return nil, fmt.Errorf("No host is named %s", name)
+	}
+
+	return s.Clients.Get(host)
+}
+
+// Retrieve the Docker client targeted by the command (its host, or the default one)
+// Handle ensures the command's host exists before dispatching it
+func (s *Server) ClientFor(command ui.Command) *client.Client {
+	if command.Host != "" {
+		if c, err := s.HostClient(command.Host); err == nil {
+			return c
+		}
+	}
+
+	_, c := s.CurrentHost()
+	return c
+}
+
+// Retrieve the default host's name and client
+func (s *Server) CurrentHost() (string, *client.Client) {
+	s.hostMutex.RLock()
+	defer s.hostMutex.RUnlock()
+
+	return s.CurrentHostName, s.Docker
+}
+
+// Set the default host, used by commands that don't specify theirs
+func (s *Server) SetHost(name string) error {
+	c, err := s.HostClient(name)
+	if err != nil {
+		return err
+	}
+
+	s.hostMutex.Lock()
+	defer s.hostMutex.Unlock()
+
+	s.Docker = c
+	s.CurrentHostName = name
+
+	return nil
+}
+
+// Retrieve the host a command from the session should target when it doesn't specify one :
+// The host the session used last, or the default host, or the first host the session may access
+func (s *Server) sessionHost(session _session.GenericSession) string {
+	permitted := s.permittedHosts(session)
+
+	if host, exists := session.Get("host"); exists && slices.Contains(permitted, host.(string)) {
+		return host.(string)
+	}
+
+	if current, _ := s.CurrentHost(); slices.Contains(permitted, current) {
+		return current
+	}
+
+	if len(permitted) > 0 {
+		return permitted[0]
+	}
+
+	return ""
+}
+
+// Retrieve a copy of the hosts currently known, safe for concurrent use while they're reloaded
+func (s *Server) KnownHosts() HostsArray {
+	s.hostMutex.RLock()
+	defer s.hostMutex.RUnlock()
+
+	return slices.Clone(s.Hosts)
+}
+
+// Retrieve the names of the hosts that didn't answer their last check
+func (s *Server) OfflineHosts() []string {
+	s.hostMutex.RLock()
+	defer s.hostMutex.RUnlock()
+
+	offline := make([]string, 0)
+	for _, h := range s.Hosts {
+		if _, isOffline := s.offlineHosts[h[0]]; isOffline {
+			offline = append(offline, h[0])
+		}
+	}
+
+	return offline
+}
+
+// Check whether every known host answers, in parallel, marking the unreachable ones offline
+// Returns whether any host went offline, or came back online
+func (s *Server) CheckHosts() bool {
+	hosts := s.KnownHosts()
+	results := make([]HealthHost, len(hosts))
+
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.Clients.Get(h)
+			if err != nil {
+				results[i] = HealthHost{Name: h[0], Error: err.Error()}
+				return
+			}
+			results[i] = checkDockerHost(h[0], c)
+		}()
+	}
+	wg.Wait()
+
+	s.hostMutex.Lock()
+	defer s.hostMutex.Unlock()
+
+	previous := s.offlineHosts
+	s.offlineHosts = make(map[string]string)
+	changed := false
+
+	for _, r := range results {
+		_, wasOffline := previous[r.Name]
+
+		if !r.Reachable {
+			s.offlineHosts[r.Name] = r.Error
+			if !wasOffline {
+				log.Printf("Docker host %s is offline -> %s", r.Name, r.Error)
+				changed = true
+			}
+		} else if wasOffline {
+			log.Printf("Docker host %s is back online", r.Name)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// Replace the known hosts, forgetting the clients of the removed ones, and notify all the clients
+func (s *Server) ReloadHosts(hosts HostsArray) {
+	s.hostMutex.Lock()
+	previous := s.Hosts
+	s.Hosts = hosts
+	current := s.CurrentHostName
+	s.hostMutex.Unlock()
+
+	for _, h := range previous {
+		if host, exists := hosts.Find(h[0]); !exists || !slices.Equal(host, h) {
+			s.Clients.Forget(h[0])
+		}
+	}
+
+	// Keep the default host when it still exists, refreshing its client in case its definition changed
+	if _, exists := hosts.Address(current); !exists && len(hosts) > 0 {
+		current = hosts[0][0]
+	}
+	if current != "" {
+		s.SetHost(current)
+	}
+
+	s.CheckHosts()
+	s.BroadcastHosts()
+}
+
+// Watch the hosts file, reloading the hosts whenever it changes, and periodically check their reachability
+func (s *Server) WatchHosts(path string) {
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	lastCheck := time.Now()
+	for range time.Tick(hostsWatchInterval) {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(modified) {
+			modified = info.ModTime()
+
+			hosts, err := LoadHosts(path)
+			if err != nil {
+				log.Printf("Error reloading %s, keeping the previous hosts -> %s", path, err)
+			} else if hosts.String() != s.KnownHosts().String() {
+				log.Printf("Reloading the Docker hosts from %s (%d hosts)", path, len(hosts))
+				s.ReloadHosts(hosts)
+				lastCheck = time.Now()
+			}
+		}
+
+		if time.Since(lastCheck) >= hostsCheckInterval {
+			if s.CheckHosts() {
+				s.BroadcastHosts()
+			}
+			lastCheck = time.Now()
+		}
+	}
+}
+
+// Persist the given hosts in the hosts file (atomically), then apply them
+// Must be called with hostsFileMutex held, so that concurrent additions / removals don't overwrite each other
+func (s *Server) saveHosts(hosts HostsArray) error {
+	if err := _os.WriteFileAtomically(HostsFile, []byte(hosts.String()), 0644); err != nil {
+		return err
+	}
+
+	s.ReloadHosts(hosts)
+	return nil
+}
+
+// Notify all the clients about the current list of hosts, each of them seeing only the hosts they may access
+func (s *Server) BroadcastHosts() {
+	offline := s.OfflineHosts()
+
+	sessions, _ := s.Melody.Sessions()
+	for _, session := range sessions {
+		if !isAuthenticatedClient(session) {
+			continue
+		}
+
+		permitted := s.permittedHosts(session)
+		notification := ui.NotificationData(ui.NotificationParams{Content: ui.JSON{
+			"Hosts":        permitted,
+			"OfflineHosts": slices.DeleteFunc(slices.Clone(offline), func(h string) bool { return !slices.Contains(permitted, h) }),
+		}})
+		session.Write(notification.ToBytes())
+	}
+}
+
+// Placeholder used for internal organization
+type Hosts struct{}
+
+func (Hosts) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" || _os.GetEnv("SERVER_ROLE") == "Agent" {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "Hosts can be managed only on a Master node with multi-host enabled"}}),
+		)
+		return
+	}
+
+	switch command.Action {
+
+	// Command : List the known hosts, with their address and status
+	case "host.list":
+		server.hostMutex.RLock()
+		hosts := make([]ui.JSON, 0, len(server.Hosts))
+		for _, h := range server.Hosts {
+			reason, isOffline := server.offlineHosts[h[0]]
+			hosts = append(hosts, ui.JSON{"Name": h[0], "Address": h[1], "Options": h[2:], "Offline": isOffline, "Error": reason})
+		}
+		server.hostMutex.RUnlock()
+
+		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"DockerHosts": hosts}}))
+
+	// Command : Add a new host, persisted in the hosts file
+	case "host.add":
+		var args hostAddArgs
+		mapstructure.Decode(command.Args, &args)
+
+		server.hostsFileMutex.Lock()
+		defer server.hostsFileMutex.Unlock()
+
+		hosts := server.KnownHosts()
+		if err := validateHost(args.Name, args.Address, args.Options, hosts); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		if err := server.saveHosts(append(hosts, append([]string{args.Name, args.Address}, args.Options...))); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		message := fmt.Sprintf("The host %s was added", args.Name)
+		if slices.Contains(server.OfflineHosts(), args.Name) {
+			message += ", but it doesn't answer yet"
+		}
+		log.Printf("Docker host %s (%s) added", args.Name, args.Address)
+		server.SendNotification(session, ui.NotificationSuccess(ui.NP{Content: ui.JSON{"Message": message}}))
+
+	// Command : Remove a host from the hosts file
+	case "host.remove":
+		var args hostRemoveArgs
+		mapstructure.Decode(command.Args, &args)
+
+		server.hostsFileMutex.Lock()
+		defer server.hostsFileMutex.Unlock()
+
+		hosts := server.KnownHosts()
+		if _, exists := hosts.Address(args.Name); !exists {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("No host is named %s", args.Name)}}))
+			break
+		}
+		if len(hosts) == 1 {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "The last host can't be removed"}}))
+			break
+		}
+
+		hosts = slices.DeleteFunc(hosts, func(h []string) bool { return h[0] == args.Name })
+		if err := server.saveHosts(hosts); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			break
+		}
+
+		log.Printf("Docker host %s removed", args.Name)
+		server.SendNotification(session, ui.NotificationSuccess(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("The host %s was removed", args.Name)}}))
+
+	// Command : Check whether a known host, or any address, answers
+	case "host.test":
+		var args hostTestArgs
+		mapstructure.Decode(command.Args, &args)
+
+		var result HealthHost
+		switch {
+		case args.Address != "":
+			if err := validateHost("test", args.Address, args.Options, nil); err != nil {
+				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+				return
+			}
+
+			c, err := newHostClient(append([]string{"test", args.Address}, args.Options...))
+			if err != nil {
+				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+				return
+			}
+			defer _client.Close(c)
+			result = checkDockerHost(args.Address, c)
+		case args.Name != "":
+			c, err := server.HostClient(args.Name)
+			if err != nil {
+				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+				return
+			}
+
+			result = checkDockerHost(args.Name, c)
+
+			// Refresh the host's status for everyone when it changed
+			if slices.Contains(server.OfflineHosts(), args.Name) == result.Reachable {
+				if server.CheckHosts() {
+					server.BroadcastHosts()
+				}
+			}
+		default:
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": "Missing argument : Name or Address"}}))
+			return
+		}
+
+		if !result.Reachable {
+			server.SendNotification(
+				session,
+				ui.NotificationError(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("%s doesn't answer -> %s", result.Name, result.Error)}}),
+			)
+			break
+		}
+
+		server.SendNotification(
+			session,
+			ui.NotificationSuccess(ui.NP{Content: ui.JSON{
+				"Message": fmt.Sprintf("%s answered in %d ms (Docker %s, API %s)", result.Name, result.LatencyMs, result.Version, result.APIVersion),
+			}}),
+		)
+
+	// Command not found
+	default:
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("This command is unknown, unsupported, or not implemented yet : %s", command.Action),
+				},
+			}),
+		)
+	}
+}
@@ -19,11 +19,13 @@ import (
 type Images struct{}
 
 func (Images) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	switch command.Action {
 
 	// Single - Default menu
 	case "image.menu":
-		actions := resources.ImageSingleActions()
+		actions := server.allowedActions(session, resources.ImageSingleActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Single - Remove menu
@@ -31,18 +33,18 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var volume resources.Volume
 		mapstructure.Decode(command.Args["Resource"], &volume)
 
-		actions := resources.ImageRemoveActions(volume)
+		actions := server.allowedActions(session, resources.ImageRemoveActions(volume))
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - Bulk menu
 	case "images.bulk":
-		actions := resources.ImagesBulkActions()
+		actions := server.allowedActions(session, resources.ImagesBulkActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - List
 	case "images.list":
 		columns := strings.Split(_os.GetEnv("COLUMNS_IMAGES"), ",")
-		images := resources.ImagesList(server.Docker)
+		images := resources.ImagesList(docker)
 
 		rows := images.ToRows(columns)
 
@@ -73,7 +75,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Prune
 	case "images.prune":
-		err := resources.ImagesPrune(server.Docker)
+		err := resources.ImagesPrune(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -87,7 +89,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Pull
 	case "images.pull":
-		images := resources.ImagesList(server.Docker)
+		images := resources.ImagesList(docker)
 
 		for _, image := range images {
 			if image.Version != "latest" {
@@ -131,7 +133,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 					)
 				},
 			}
-			task.RunSync(server.Docker)
+			task.RunSync(docker)
 		}
 		server.SendNotification(
 			session,
@@ -145,7 +147,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
 
-		err := image.Remove(server.Docker, false, true)
+		err := image.Remove(docker, false, true)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -163,7 +165,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
 
-		err := image.Remove(server.Docker, false, false)
+		err := image.Remove(docker, false, false)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -181,7 +183,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
 
-		err := image.Remove(server.Docker, true, true)
+		err := image.Remove(docker, true, true)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -199,7 +201,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
 
-		err := image.Remove(server.Docker, true, false)
+		err := image.Remove(docker, true, false)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -251,7 +253,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Single - Get inspector tabs
 	case "image.inspect.tabs":
@@ -267,7 +269,7 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 	case "image.inspect.config":
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
-		config, err := image.GetConfig(server.Docker)
+		config, err := image.GetConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -290,10 +292,9 @@ func (Images) RunCommand(server *Server, session _session.GenericSession, comman
 		var image resources.Image
 		mapstructure.Decode(command.Args["Resource"], &image)
 
-		var name string
-		name = command.Args["Name"].(string)
+		name, _ := command.Args["Name"].(string)
 
-		err := image.Run(server.Docker, name)
+		err := image.Run(docker, name)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
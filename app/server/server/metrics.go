@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"will-moss/isaiah/server/_internal/metrics"
+	_os "will-moss/isaiah/server/_internal/os"
+	"will-moss/isaiah/server/resources"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Maximum duration the Master node waits for an agent to send its metrics
+const metricsAgentTimeout = 10 * time.Second
+
+// Maximum duration of the queries sent to a single Docker host while collecting its measures
+const metricsHostTimeout = 10 * time.Second
+
+// Maximum number of containers whose stats are retrieved at the same time, per host
+const metricsStatsConcurrency = 8
+
+// Upper bounds of the commands' latency histogram, in seconds (long tasks such as updates can take minutes)
+var commandLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Represent Isaiah's own metrics
+type Metrics struct {
+	Commands metrics.CounterVec   // Commands handled, by action and outcome
+	Latency  metrics.HistogramVec // Commands' duration, by action
+
+	once sync.Once
+}
+
+// Represent the Docker-level measures of a host, by metric name
+type DockerMetrics map[string][]metrics.Sample
+
+// Docker-level metrics, in the order they're exposed
+var dockerMetricsHelp = [][2]string{
+	{"isaiah_docker_up", "Whether the Docker host is reachable (1) or not (0)"},
+	{"isaiah_docker_containers", "Number of containers, by state"},
+	{"isaiah_docker_images", "Number of images"},
+	{"isaiah_docker_images_size_bytes", "Total size of the images"},
+	{"isaiah_docker_volumes", "Number of volumes"},
+	{"isaiah_docker_volumes_size_bytes", "Total size of the volumes (when reported by Docker)"},
+	{"isaiah_docker_container_cpu_percent", "CPU usage of the running containers, as a percentage of the host's total"},
+	{"isaiah_docker_container_memory_usage_bytes", "Memory usage of the running containers"},
+	{"isaiah_docker_container_memory_limit_bytes", "Memory limit of the running containers"},
+}
+
+// Determine whether metrics are collected and exposed
+func metricsEnabled() bool {
+	return _os.GetEnv("METRICS_ENABLED") == "TRUE"
+}
+
+// Record the outcome and duration of a handled command
+func (m *Metrics) RecordCommand(action string, outcome string, duration time.Duration) {
+	m.Commands.Add(1, action, outcome)
+
+	m.once.Do(func() { m.Latency.Buckets = commandLatencyBuckets })
+	m.Latency.Observe(duration.Seconds(), action)
+}
+
+// Append a sample to the given metric
+func (d DockerMetrics) add(name string, value float64, labels map[string]string) {
+	d[name] = append(d[name], metrics.Sample{Labels: labels, Value: value})
+}
+
+// Collect the Docker-level measures of the given host, whose queries share a single timeout
+// Containers' CPU and memory usage come from the same stats as the inspector's Stats tab
+func CollectDockerMetrics(client *client.Client) DockerMetrics {
+	collected := make(DockerMetrics)
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsHostTimeout)
+	defer cancel()
+
+	if _, err := client.Ping(ctx); err != nil {
+		collected.add("isaiah_docker_up", 0, map[string]string{})
+		return collected
+	}
+	collected.add("isaiah_docker_up", 1, map[string]string{})
+
+	// Containers, by state
+	containers, err := client.ContainerList(ctx, container.ListOptions{All: true})
+	if err == nil {
+		states := make(map[string]int)
+		for _, c := range containers {
+			states[c.State]++
+		}
+		for _, state := range []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"} {
+			collected.add("isaiah_docker_containers", float64(states[state]), map[string]string{"state": state})
+		}
+	}
+
+	// Images
+	if images, err := client.ImageList(ctx, image.ListOptions{All: true}); err == nil {
+		size := int64(0)
+		for _, i := range images {
+			size += i.Size
+		}
+		collected.add("isaiah_docker_images", float64(len(images)), map[string]string{})
+		collected.add("isaiah_docker_images_size_bytes", float64(size), map[string]string{})
+	}
+
+	// Volumes (sizes are computed by Docker, which may take a while on large volumes)
+	if volumes, err := client.VolumeList(ctx, volume.ListOptions{}); err == nil {
+		collected.add("isaiah_docker_volumes", float64(len(volumes.Volumes)), map[string]string{})
+	}
+	if usage, err := client.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}}); err == nil {
+		size := int64(0)
+		for _, v := range usage.Volumes {
+			if v.UsageData != nil && v.UsageData.Size > 0 {
+				size += v.UsageData.Size
+			}
+		}
+		collected.add("isaiah_docker_volumes_size_bytes", float64(size), map[string]string{})
+	}
+
+	// Running containers' usage
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, metricsStatsConcurrency)
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c container.Summary) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			information, err := client.ContainerStatsOneShot(ctx, c.ID)
+			if err != nil {
+				return
+			}
+			defer information.Body.Close()
+
+			var stats container.StatsResponse
+			if err := json.NewDecoder(information.Body).Decode(&stats); err != nil {
+				return
+			}
+
+			labels := map[string]string{"container": strings.TrimPrefix(c.Names[0], "/")}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			collected.add("isaiah_docker_container_cpu_percent", resources.CPUPercent(stats), labels)
+			collected.add("isaiah_docker_container_memory_usage_bytes", float64(stats.MemoryStats.Usage), labels)
+			collected.add("isaiah_docker_container_memory_limit_bytes", float64(stats.MemoryStats.Limit), labels)
+		}(c)
+	}
+	wg.Wait()
+
+	return collected
+}
+
+// Label every sample of the given measures with the host and agent they come from, and merge them into the given ones
+func (d DockerMetrics) merge(collected DockerMetrics, host string, agent string) {
+	for name, samples := range collected {
+		for _, s := range samples {
+			labels := map[string]string{"host": host, "agent": agent}
+			for k, v := range s.Labels {
+				labels[k] = v
+			}
+			d.add(name, s.Value, labels)
+		}
+	}
+}
+
+// Master - Collect the Docker-level measures of every host, and every agent, in parallel
+func (server *Server) collectAllDockerMetrics() DockerMetrics {
+	all := make(DockerMetrics)
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	gather := func(host string, agent string, collect func() DockerMetrics) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collected := collect()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			all.merge(collected, host, agent)
+		}()
+	}
+
+	// Docker hosts of the Master node
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
+		offline := server.OfflineHosts()
+		for _, h := range server.KnownHosts() {
+			// Hosts marked offline are reported as down right away, rather than waiting for them to time out
+			if slices.Contains(offline, h[0]) {
+				gather(h[0], "Master", func() DockerMetrics {
+					return DockerMetrics{"isaiah_docker_up": {{Labels: map[string]string{}, Value: 0}}}
+				})
+				continue
+			}
+
+			gather(h[0], "Master", func() DockerMetrics {
+				c, err := server.Clients.Get(h)
+				if err != nil {
+					return DockerMetrics{"isaiah_docker_up": {{Labels: map[string]string{}, Value: 0}}}
+				}
+				return CollectDockerMetrics(c)
+			})
+		}
+	} else {
+		gather("local", "Master", func() DockerMetrics { return CollectDockerMetrics(server.Docker) })
+	}
+
+	// Agents, asked over their connection
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		agent, isAgent := s.Get("agent")
+		if !isAgent {
+			continue
+		}
+
+		gather("local", agent.(Agent).Name, func() DockerMetrics {
+			id := uuid.NewString()
+			replies := server.APIReplies.wait(id)
+			defer server.APIReplies.release(id)
+
+			s.Write(ui.Command{Action: "agent.metrics", Initiator: id}.ToBytes())
+
+			unreachable := DockerMetrics{"isaiah_docker_up": {{Labels: map[string]string{}, Value: 0}}}
+			timeout := time.After(metricsAgentTimeout)
+			for {
+				select {
+				case notification := <-replies:
+					if raw, exists := notification.Content["Metrics"]; exists {
+						var collected DockerMetrics
+						mapstructure.Decode(raw, &collected)
+						return collected
+					}
+
+					if notification.Type == ui.TypeError {
+						return unreachable
+					}
+
+				case <-timeout:
+					return unreachable
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+	return all
+}
+
+// HTTP - Expose the metrics in the Prometheus text format
+func (server *Server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !checkPeerAccess(newAPISession(r), PeerClient) {
+		http.Error(w, "Your address isn't allowed to access the metrics", http.StatusForbidden)
+		return
+	}
+
+	// When a token is configured, Prometheus must send it (bearer_token / authorization in the scrape config)
+	if token := _os.GetEnv("METRICS_TOKEN"); token != "" {
+		supplied := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(supplied), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "A valid metrics token is required", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	// Docker
+	docker := server.collectAllDockerMetrics()
+	for _, metric := range dockerMetricsHelp {
+		metrics.WriteGauge(w, metric[0], metric[1], docker[metric[0]])
+	}
+
+	// Isaiah
+	clients := 0
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		if _, isAgent := s.Get("agent"); !isAgent {
+			clients++
+		}
+	}
+
+	metrics.WriteGauge(w, "isaiah_sessions", "Number of clients connected", []metrics.Sample{{Value: float64(clients)}})
+	metrics.WriteGauge(w, "isaiah_agents", "Number of agents registered", []metrics.Sample{{Value: float64(len(server.KnownAgents()))}})
+	server.Metrics.Commands.Write(w, "isaiah_commands_total", "Number of commands handled, by action and outcome", "action", "outcome")
+	server.Metrics.Latency.Write(w, "isaiah_command_duration_seconds", "Duration of the commands handled, by action", "action")
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"will-moss/isaiah/server/ui"
+)
+
+// Decode the notifications an agent replied with (wrapped in agent.reply commands)
+func agentReplies(t *testing.T, session *testSession) []ui.Notification {
+	var notifications []ui.Notification
+	for _, message := range session.messages {
+		var command struct {
+			Action string
+			Args   struct{ Notification ui.Notification }
+		}
+		if err := json.Unmarshal([]byte(message), &command); err != nil {
+			t.Fatal(err)
+		}
+		if command.Action == "agent.reply" {
+			notifications = append(notifications, command.Args.Notification)
+		}
+	}
+
+	return notifications
+}
+
+// An agent with authentication enabled replies with its metrics to Master, without authenticating Master's request
+func TestAgentMetricsWithAuthentication(t *testing.T) {
+	t.Setenv("SERVER_ROLE", "Agent")
+	t.Setenv("AUTHENTICATION_ENABLED", "TRUE")
+
+	session := &testSession{keys: map[string]interface{}{"id": "master"}}
+	newTestServer().Handle(session, ui.Command{Action: "agent.metrics", Initiator: "metrics-request"}.ToBytes())
+
+	replies := agentReplies(t, session)
+	if len(replies) != 1 {
+		t.Fatalf("Expected a single reply, got %d : %v", len(replies), session.messages)
+	}
+	if _, exists := replies[0].Content["Metrics"]; !exists {
+		t.Errorf("Expected the agent's metrics, got %v", replies[0])
+	}
+
+	// The initiator isn't authenticated by the request, and can't run anything else
+	if authenticated, _ := session.Get("authenticated"); authenticated == true {
+		t.Errorf("Expected the initiator to remain unauthenticated")
+	}
+}
+
+// Clients can't have Master forward its own requests to agents on their behalf
+func TestAgentMetricsRefusedFromClients(t *testing.T) {
+	t.Setenv("SERVER_ROLE", "Master")
+	t.Setenv("AUTHENTICATION_ENABLED", "TRUE")
+
+	session := newTestSession()
+	newTestServer().Handle(session, ui.Command{Action: "agent.metrics", Agent: "edge"}.ToBytes())
+
+	if len(session.messages) != 1 || !strings.Contains(session.messages[0], "reserved to the Master node") {
+		t.Errorf("Expected the command to be refused, got %v", session.messages)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+
+	"github.com/gorilla/websocket"
+	"github.com/olahol/melody"
+)
+
+// Read a PEM bundle of certificates, to be used as trusted authorities
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("%s doesn't contain any PEM certificate", path)
+	}
+
+	return pool, nil
+}
+
+// Master - Build the TLS configuration that requests client certificates from agents
+// Certificates are optional at the TLS level (browsers don't present any), and required on agent registration
+func AgentsTLSConfig() (*tls.Config, error) {
+	pool, err := LoadCertPool(_os.GetEnv("AGENT_CA_FILE"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  pool,
+	}, nil
+}
+
+// Agent - Build the websocket dialer used to connect to the Master node
+// When MASTER_TLS_ENABLED is set, the connection uses wss, presents the agent's certificate if any,
+// and verifies the Master's certificate against MASTER_CA_FILE if any (or the system's authorities)
+func MasterDialer() (*websocket.Dialer, string, error) {
+	if _os.GetEnv("MASTER_TLS_ENABLED") != "TRUE" {
+		return websocket.DefaultDialer, "ws", nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if _os.GetEnv("AGENT_CERTIFICATE_FILE") != "" {
+		certificate, err := tls.LoadX509KeyPair(_os.GetEnv("AGENT_CERTIFICATE_FILE"), _os.GetEnv("AGENT_KEY_FILE"))
+		if err != nil {
+			return nil, "", err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	if _os.GetEnv("MASTER_CA_FILE") != "" {
+		pool, err := LoadCertPool(_os.GetEnv("MASTER_CA_FILE"))
+		if err != nil {
+			return nil, "", err
+		}
+		config.RootCAs = pool
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = config
+
+	return &dialer, "wss", nil
+}
+
+// Retrieve the verified certificate presented by the session's peer, if any
+func peerCertificate(session _session.GenericSession) *x509.Certificate {
+	session = unwrapSession(session)
+
+	s, ok := session.(*melody.Session)
+	if !ok || s.Request.TLS == nil || len(s.Request.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return s.Request.TLS.VerifiedChains[0][0]
+}
+
+// Ensure the agent registering on the session presented a certificate issued for its name (CN or SAN)
+// Enforced only when the Master was configured with a CA bundle for agents
+func verifyAgentCertificate(session _session.GenericSession, name string) error {
+	if _os.GetEnv("AGENT_CA_FILE") == "" {
+		return nil
+	}
+
+	certificate := peerCertificate(session)
+	if certificate == nil {
+		return fmt.Errorf("A valid client certificate is required to register as an agent")
+	}
+
+	if certificate.Subject.CommonName != name && !slices.Contains(certificate.DNSNames, name) {
+		return fmt.Errorf("The client certificate wasn't issued for the agent %s", name)
+	}
+
+	return nil
+}
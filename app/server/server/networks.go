@@ -17,6 +17,8 @@ import (
 type Networks struct{}
 
 func (Networks) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	switch command.Action {
 
 	// Single - Default menu
@@ -24,7 +26,7 @@ func (Networks) RunCommand(server *Server, session _session.GenericSession, comm
 		var network resources.Network
 		mapstructure.Decode(command.Args["Resource"], &network)
 
-		actions := resources.NetworkSingleActions(network)
+		actions := server.allowedActions(session, resources.NetworkSingleActions(network))
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Single - Remove menu
@@ -32,18 +34,18 @@ func (Networks) RunCommand(server *Server, session _session.GenericSession, comm
 		var network resources.Network
 		mapstructure.Decode(command.Args["Resource"], &network)
 
-		actions := resources.NetworkRemoveActions(network)
+		actions := server.allowedActions(session, resources.NetworkRemoveActions(network))
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - Bulk menu
 	case "networks.bulk":
-		actions := resources.NetworksBulkActions()
+		actions := server.allowedActions(session, resources.NetworksBulkActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - List
 	case "networks.list":
 		columns := strings.Split(_os.GetEnv("COLUMNS_NETWORKS"), ",")
-		networks := resources.NetworksList(server.Docker)
+		networks := resources.NetworksList(docker)
 
 		rows := networks.ToRows(columns)
 
@@ -74,7 +76,7 @@ func (Networks) RunCommand(server *Server, session _session.GenericSession, comm
 
 	// Bulk - Prune
 	case "networks.prune":
-		err := resources.NetworksPrune(server.Docker)
+		err := resources.NetworksPrune(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -91,7 +93,7 @@ func (Networks) RunCommand(server *Server, session _session.GenericSession, comm
 		var network resources.Network
 		mapstructure.Decode(command.Args["Resource"], &network)
 
-		err := network.Remove(server.Docker)
+		err := network.Remove(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -117,7 +119,7 @@ func (Networks) RunCommand(server *Server, session _session.GenericSession, comm
 	case "network.inspect.config":
 		var network resources.Network
 		mapstructure.Decode(command.Args["Resource"], &network)
-		config, err := network.GetConfig(server.Docker)
+		config, err := network.GetConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
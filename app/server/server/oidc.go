@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"will-moss/isaiah/server/_internal/oidc"
+	_os "will-moss/isaiah/server/_internal/os"
+	"will-moss/isaiah/server/_internal/token"
+)
+
+// Name of the cookie carrying the session token of users logged in via OpenID Connect
+const SessionCookieName = "isaiah_session"
+
+// Duration a user has to complete their login on the OpenID Connect provider
+const oidcLoginWindow = 10 * time.Minute
+
+// Represent a login that was started on the OpenID Connect provider, and not completed yet
+type oidcLogin struct {
+	Nonce    string
+	Verifier string
+	Expires  time.Time
+}
+
+// Represent the OpenID Connect login state (provider's configuration, pending logins)
+type SingleSignOn struct {
+	mutex    sync.Mutex
+	provider *oidc.Provider
+	pending  map[string]oidcLogin // State -> Pending login
+}
+
+// Lazily retrieve the provider's configuration, retrying on every call until it succeeds
+func (o *SingleSignOn) load(ctx context.Context) (*oidc.Provider, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, _os.GetEnv("OIDC_ISSUER"))
+	if err != nil {
+		return nil, err
+	}
+
+	o.provider = provider
+	return provider, nil
+}
+
+// Retrieve the scopes requested to the provider
+func oidcScopes() []string {
+	scopes := strings.Fields(strings.ReplaceAll(_os.GetEnv("OIDC_SCOPES"), ",", " "))
+	for _, s := range scopes {
+		if s == "openid" {
+			return scopes
+		}
+	}
+
+	return append([]string{"openid"}, scopes...)
+}
+
+// Determine the Isaiah role granted by the given groups, using the OIDC_ROLES_MAPPING setting
+// Format : group:role,group:role (the highest role wins, OIDC_DEFAULT_ROLE applies when none matches)
+func oidcRole(groups []string) string {
+	role := ""
+
+	for _, mapping := range strings.Split(_os.GetEnv("OIDC_ROLES_MAPPING"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(mapping), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		group, mapped := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !slices.Contains(rolesHierarchy, mapped) {
+			continue
+		}
+
+		for _, g := range groups {
+			if g == group && slices.Index(rolesHierarchy, mapped) > slices.Index(rolesHierarchy, role) {
+				role = mapped
+			}
+		}
+	}
+
+	if role == "" {
+		role = _os.GetEnv("OIDC_DEFAULT_ROLE")
+	}
+
+	if !slices.Contains(rolesHierarchy, role) {
+		return ""
+	}
+
+	return role
+}
+
+// HTTP - Redirect the user to the provider, to start the authorization-code flow
+func (o *SingleSignOn) Login(w http.ResponseWriter, r *http.Request) {
+	provider, err := o.load(r.Context())
+	if err != nil {
+		log.Printf("Error retrieving the OpenID Connect provider's configuration -> %s", err)
+		http.Error(w, "The identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+
+	o.mutex.Lock()
+	if o.pending == nil {
+		o.pending = make(map[string]oidcLogin)
+	}
+	now := time.Now()
+	for k, v := range o.pending {
+		if now.After(v.Expires) {
+			delete(o.pending, k)
+		}
+	}
+	o.pending[state] = oidcLogin{Nonce: nonce, Verifier: verifier, Expires: now.Add(oidcLoginWindow)}
+	o.mutex.Unlock()
+
+	http.Redirect(
+		w,
+		r,
+		provider.AuthCodeURL(_os.GetEnv("OIDC_CLIENT_ID"), _os.GetEnv("OIDC_REDIRECT_URL"), oidcScopes(), state, nonce, verifier),
+		http.StatusFound,
+	)
+}
+
+// HTTP - Complete the authorization-code flow, and bind the browser to a new session via a cookie
+func (o *SingleSignOn) Callback(server *Server, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	address := requestAddress(r)
+
+	if e := query.Get("error"); e != "" {
+		log.Printf("OpenID Connect login refused by the provider for %s -> %s %s", address, e, query.Get("error_description"))
+		http.Error(w, "The identity provider refused the login", http.StatusUnauthorized)
+		return
+	}
+
+	// Ensure the callback matches a login started here (CSRF protection)
+	o.mutex.Lock()
+	login, exists := o.pending[query.Get("state")]
+	delete(o.pending, query.Get("state"))
+	o.mutex.Unlock()
+
+	if !exists || time.Now().After(login.Expires) {
+		http.Error(w, "The login request is unknown or has expired, please retry", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := o.load(r.Context())
+	if err != nil {
+		log.Printf("Error retrieving the OpenID Connect provider's configuration -> %s", err)
+		http.Error(w, "The identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	raw, err := provider.Exchange(
+		r.Context(),
+		_os.GetEnv("OIDC_CLIENT_ID"),
+		_os.GetEnv("OIDC_CLIENT_SECRET"),
+		_os.GetEnv("OIDC_REDIRECT_URL"),
+		query.Get("code"),
+		login.Verifier,
+	)
+	if err != nil {
+		log.Printf("Error exchanging the OpenID Connect code for %s -> %s", address, err)
+		http.Error(w, "The login couldn't be completed", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := provider.Verify(r.Context(), raw, _os.GetEnv("OIDC_CLIENT_ID"), login.Nonce)
+	if err != nil {
+		log.Printf("Error verifying the OpenID Connect ID token for %s -> %s", address, err)
+		http.Error(w, "The login couldn't be completed", http.StatusUnauthorized)
+		return
+	}
+
+	username := claims.String(_os.GetEnv("OIDC_USERNAME_CLAIM"))
+	if username == "" {
+		username = claims.String("sub")
+	}
+
+	role := oidcRole(claims.Strings(_os.GetEnv("OIDC_GROUPS_CLAIM")))
+	if role == "" {
+		log.Printf("Refused OpenID Connect login from %s (account: %q) : no role matches their groups", address, username)
+		http.Error(w, "Your account isn't allowed to access Isaiah", http.StatusForbidden)
+		return
+	}
+
+	signed, issued := server.Tokens.Issue(username, role)
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    signed,
+		Path:     "/",
+		Expires:  time.Unix(issued.Expires, 0),
+		HttpOnly: true,
+		Secure:   _os.GetEnv("SSL_ENABLED") == "TRUE" || strings.HasPrefix(_os.GetEnv("OIDC_REDIRECT_URL"), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	log.Printf("OpenID Connect login from %s (account: %q, role: %s)", address, username, role)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Verify the session cookie attached to the given request (typically, the websocket upgrade)
+func (o *SingleSignOn) Authenticate(server *Server, r *http.Request) (token.Claims, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return token.Claims{}, err
+	}
+
+	claims, err := server.Tokens.Verify(cookie.Value)
+	if err != nil {
+		return claims, fmt.Errorf("Invalid session cookie -> %s", err)
+	}
+
+	return claims, nil
+}
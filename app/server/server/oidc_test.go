@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"will-moss/isaiah/server/_internal/oidc"
+)
+
+const testClientID = "isaiah"
+const testNonce = "nonce"
+
+// Represent a minimal OpenID Connect provider (discovery, key set, and token endpoint), signing with a single RSA key
+type testProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string // Returned by the token endpoint
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.server.URL,
+			"authorization_endpoint": provider.server.URL + "/authorize",
+			"token_endpoint":         provider.server.URL + "/token",
+			"jwks_uri":               provider.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": provider.idToken})
+	})
+
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+
+	return provider
+}
+
+// Build an ID token with the given claims, signed (RS256) with the given key
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Build the claims of a valid ID token issued by the given provider
+func validClaims(provider *testProvider) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    provider.server.URL,
+		"aud":    testClientID,
+		"sub":    "alice",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  testNonce,
+		"groups": []string{"admins"},
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	provider := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovered, err := oidc.Discover(context.Background(), provider.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims(provider)
+		claims[name] = value
+		return claims
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"valid token", signToken(t, provider.key, validClaims(provider)), nil},
+		{"valid token, among several audiences", signToken(t, provider.key, with("aud", []string{"other", testClientID})), nil},
+		{"bad signature", signToken(t, otherKey, validClaims(provider)), oidc.ErrSignature},
+		{"wrong audience", signToken(t, provider.key, with("aud", "other")), oidc.ErrClaims},
+		{"expired token", signToken(t, provider.key, with("exp", time.Now().Add(-time.Minute).Unix())), oidc.ErrClaims},
+		{"wrong issuer", signToken(t, provider.key, with("iss", "https://attacker.example")), oidc.ErrClaims},
+		{"wrong nonce", signToken(t, provider.key, with("nonce", "replayed")), oidc.ErrClaims},
+		{"malformed token", "not-a-token", oidc.ErrMalformed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims, err := discovered.Verify(context.Background(), c.token, testClientID, testNonce)
+
+			if !errors.Is(err, c.expected) {
+				t.Fatalf("Expected %v, got %v", c.expected, err)
+			}
+			if c.expected == nil && claims.String("sub") != "alice" {
+				t.Errorf("Expected the subject to be alice, got %q", claims.String("sub"))
+			}
+		})
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	provider := newTestProvider(t)
+	provider.idToken = signToken(t, provider.key, validClaims(provider))
+
+	discovered, err := oidc.Discover(context.Background(), provider.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := discovered.Exchange(context.Background(), testClientID, "secret", "https://isaiah.local/auth/oidc/callback", "code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := discovered.Verify(context.Background(), raw, testClientID, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := claims.Strings("groups"); len(groups) != 1 || groups[0] != "admins" {
+		t.Errorf("Expected the groups to be [admins], got %v", groups)
+	}
+
+	if _, err := discovered.Exchange(context.Background(), testClientID, "secret", "https://isaiah.local/auth/oidc/callback", "wrong", "verifier"); err == nil {
+		t.Errorf("Expected a refused code to fail the exchange")
+	}
+}
+
+func TestOIDCDiscoverRefusesMismatchedIssuer(t *testing.T) {
+	provider := newTestProvider(t)
+
+	if _, err := oidc.Discover(context.Background(), provider.server.URL+"/other"); err == nil {
+		t.Errorf("Expected a mismatched issuer to be refused")
+	}
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"will-moss/isaiah/server/ui"
+)
+
+// Path of the OpenAPI document describing the REST API
+const OpenAPIPath = APIPrefix + "openapi.json"
+
+// Build the OpenAPI (3.0) document of the REST API, from its routes and their Args / Response schemas
+func OpenAPIDocument() (ui.JSON, error) {
+	schemas := ui.JSON{}
+	paths := ui.JSON{}
+
+	// Shared bodies, returned by most routes
+	for _, prototype := range []interface{}{apiMessageBody{}, apiErrorBody{}} {
+		if _, err := apiSchema(reflect.TypeOf(prototype), schemas); err != nil {
+			return nil, err
+		}
+	}
+
+	errorResponse := func(description string) ui.JSON {
+		return ui.JSON{
+			"description": description,
+			"content":     ui.JSON{"application/json": ui.JSON{"schema": ui.JSON{"$ref": "#/components/schemas/ErrorBody"}}},
+		}
+	}
+
+	for _, route := range apiRoutes {
+		path := "/" + route.Resource
+		if route.Single {
+			path += "/{id}"
+		}
+		if route.Verb != "" {
+			path += "/" + route.Verb
+		}
+
+		response, err := apiSchema(reflect.TypeOf(route.Response), schemas)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s (response) -> %s", route.Method, path, err)
+		}
+
+		parameters := []ui.JSON{
+			{"name": "host", "in": "query", "schema": ui.JSON{"type": "string"}, "description": "Name of the host to target (multi-host deployment)"},
+			{"name": "agent", "in": "query", "schema": ui.JSON{"type": "string"}, "description": "Name of the agent to target (multi-node deployment)"},
+		}
+		if route.Single {
+			parameters = append(parameters, ui.JSON{
+				"name": "id", "in": "path", "required": true, "schema": ui.JSON{"type": "string"},
+				"description": "ID, short ID, or name of the " + strings.TrimSuffix(route.Resource, "s"),
+			})
+		}
+		if route.Revealable {
+			parameters = append(parameters, ui.JSON{
+				"name": "reveal", "in": "query", "schema": ui.JSON{"type": "boolean"},
+				"description": "Show the values normally redacted (requires the role allowed to reveal them)",
+			})
+		}
+
+		status := "200"
+		if route.Verb == "create" || route.Verb == "run" {
+			status = "201"
+		}
+
+		operation := ui.JSON{
+			"operationId": route.Action,
+			"summary":     route.Summary,
+			"tags":        []string{route.Resource},
+			"parameters":  parameters,
+			"responses": ui.JSON{
+				status: ui.JSON{
+					"description": "Success",
+					"content":     ui.JSON{"application/json": ui.JSON{"schema": response}},
+				},
+				"400": errorResponse("Malformed request, or invalid arguments"),
+				"401": errorResponse("Authentication is required"),
+				"403": errorResponse("Refused by the role, API token, authorization policies, IP filtering, or read-only mode"),
+				"404": errorResponse("Unknown resource, host, or agent"),
+				"500": errorResponse("Docker failed to run the action"),
+			},
+			"x-isaiah-action": route.Action,
+			"x-isaiah-role":   RequiredRole(route.Action),
+		}
+
+		if route.Method == http.MethodPost {
+			args, err := apiSchema(reflect.TypeOf(route.Args), schemas)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s (args) -> %s", route.Method, path, err)
+			}
+
+			operation["requestBody"] = ui.JSON{
+				"required": false,
+				"content":  ui.JSON{"application/json": ui.JSON{"schema": args}},
+			}
+		}
+
+		item, _ := paths[path].(ui.JSON)
+		if item == nil {
+			item = ui.JSON{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return ui.JSON{
+		"openapi": "3.0.3",
+		"info": ui.JSON{
+			"title":       "Isaiah REST API",
+			"version":     "1",
+			"description": "JSON API mirroring the commands available in Isaiah's web interface",
+		},
+		"servers":  []ui.JSON{{"url": strings.TrimSuffix(APIPrefix, "/")}},
+		"security": []ui.JSON{{"bearer": []string{}}},
+		"paths":    paths,
+		"components": ui.JSON{
+			"schemas":         schemas,
+			"securitySchemes": ui.JSON{"bearer": ui.JSON{"type": "http", "scheme": "bearer"}},
+		},
+	}, nil
+}
+
+// Build the JSON schema of the given type, registering named structures as reusable components
+func apiSchema(t reflect.Type, components ui.JSON) (ui.JSON, error) {
+	if t == nil {
+		return nil, fmt.Errorf("No schema is declared")
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return apiSchema(t.Elem(), components)
+	case reflect.String:
+		return ui.JSON{"type": "string"}, nil
+	case reflect.Bool:
+		return ui.JSON{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ui.JSON{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return ui.JSON{"type": "number"}, nil
+	case reflect.Interface:
+		return ui.JSON{}, nil
+	case reflect.Map:
+		values, err := apiSchema(t.Elem(), components)
+		if err != nil {
+			return nil, err
+		}
+		return ui.JSON{"type": "object", "additionalProperties": values}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return ui.JSON{"type": "string", "format": "byte"}, nil
+		}
+
+		items, err := apiSchema(t.Elem(), components)
+		if err != nil {
+			return nil, err
+		}
+		return ui.JSON{"type": "array", "items": items}, nil
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return ui.JSON{"type": "string", "format": "date-time"}, nil
+		}
+
+		// Named structures are described once, and referenced everywhere else (e.g. apiRenameArgs -> RenameArgs)
+		name := strings.TrimPrefix(t.Name(), "api")
+		if name != "" {
+			if _, exists := components[name]; exists {
+				return ui.JSON{"$ref": "#/components/schemas/" + name}, nil
+			}
+			components[name] = ui.JSON{} // Placeholder, in case of recursive structures
+		}
+
+		properties := ui.JSON{}
+		required := make([]string, 0)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = field.Name
+			}
+
+			property, err := apiSchema(field.Type, components)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s -> %s", t.Name(), field.Name, err)
+			}
+			if description := field.Tag.Get("description"); description != "" {
+				// References can't carry siblings in OpenAPI 3.0, hence the wrapping
+				if _, isReference := property["$ref"]; isReference {
+					property = ui.JSON{"allOf": []ui.JSON{property}}
+				}
+				property["description"] = description
+			}
+			if field.Tag.Get("required") == "true" {
+				required = append(required, key)
+			}
+
+			properties[key] = property
+		}
+
+		schema := ui.JSON{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+
+		if name == "" {
+			return schema, nil
+		}
+
+		components[name] = schema
+		return ui.JSON{"$ref": "#/components/schemas/" + name}, nil
+	}
+
+	return nil, fmt.Errorf("Type %s can't be described in a schema", t)
+}
+
+// Ensure every route of the REST API is fully declared, and can be described in the OpenAPI document
+// Used at startup, so that a route added without its Args / Response schema prevents Isaiah from starting
+func VerifyAPIRoutes() error {
+	seen := make(map[string]bool)
+
+	for _, route := range apiRoutes {
+		key := fmt.Sprintf("%s /%s (single: %t) %s", route.Method, route.Resource, route.Single, route.Verb)
+
+		switch {
+		case route.Action == "" || route.Summary == "" || route.Run == nil:
+			return fmt.Errorf("%s -> Action, Summary, and Run are required", key)
+		case route.Args == nil || reflect.TypeOf(route.Args).Kind() != reflect.Struct:
+			return fmt.Errorf("%s -> Args must be declared as a structure (apiNoArgs{} when none)", key)
+		case route.Response == nil:
+			return fmt.Errorf("%s -> Response must be declared", key)
+		case route.Method == http.MethodGet && reflect.TypeOf(route.Args) != reflect.TypeOf(apiNoArgs{}):
+			return fmt.Errorf("%s -> GET routes can't take arguments", key)
+		case route.Revealable && route.Method != http.MethodGet:
+			return fmt.Errorf("%s -> Only GET routes can reveal redacted values", key)
+		case seen[key]:
+			return fmt.Errorf("%s -> Route is declared twice", key)
+		}
+
+		seen[key] = true
+	}
+
+	_, err := OpenAPIDocument()
+	return err
+}
+
+// HTTP - Serve the OpenAPI document of the REST API
+func (server *Server) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		writeAPIResponse(w, apiError(http.StatusInternalServerError, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(document)
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"will-moss/isaiah/server/ui"
+)
+
+// Retrieve the actions each handler's switch statements handle, by handler (empty for the server's own runCommand)
+func handlersCases(t *testing.T) map[string]map[string]bool {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := make(map[string]map[string]bool)
+	fileSet := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		parsed, err := parser.ParseFile(fileSet, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, declaration := range parsed.Decls {
+			function, ok := declaration.(*ast.FuncDecl)
+			if !ok || function.Recv == nil || (function.Name.Name != "RunCommand" && function.Name.Name != "runCommand") {
+				continue
+			}
+
+			// The server's own runCommand has a pointer receiver, and stands for the commands declared without handler
+			receiver := ""
+			if identifier, ok := function.Recv.List[0].Type.(*ast.Ident); ok {
+				receiver = identifier.Name
+			}
+			if cases[receiver] == nil {
+				cases[receiver] = make(map[string]bool)
+			}
+
+			ast.Inspect(function.Body, func(node ast.Node) bool {
+				statement, ok := node.(*ast.SwitchStmt)
+				if !ok {
+					return true
+				}
+
+				tag, ok := statement.Tag.(*ast.SelectorExpr)
+				if !ok || tag.Sel.Name != "Action" {
+					return true
+				}
+
+				for _, clause := range statement.Body.List {
+					for _, expression := range clause.(*ast.CaseClause).List {
+						if literal, ok := expression.(*ast.BasicLit); ok && literal.Kind == token.STRING {
+							action, _ := strconv.Unquote(literal.Value)
+							cases[receiver][action] = true
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	return cases
+}
+
+// Retrieve the name of the handler a command is dispatched to (empty for the server's own runCommand)
+func handlerName(definition CommandDefinition) string {
+	if definition.Handler == nil {
+		return ""
+	}
+	return reflect.TypeOf(definition.Handler).Name()
+}
+
+// Every action handled by a handler is declared in the registry, with that handler, and vice versa
+func TestHandlersMatchCommands(t *testing.T) {
+	cases := handlersCases(t)
+
+	for handler, actions := range cases {
+		for action := range actions {
+			definition, exists := FindCommand(action)
+			if !exists {
+				t.Errorf("%s handles %s, which isn't declared in the commands registry", handler, action)
+				continue
+			}
+			if handlerName(definition) != handler {
+				t.Errorf("%s handles %s, which is dispatched to %q", handler, action, handlerName(definition))
+			}
+		}
+	}
+
+	for _, definition := range commands {
+		if !cases[handlerName(definition)][definition.Name] {
+			t.Errorf("%s is declared in the commands registry, but %q doesn't handle it", definition.Name, handlerName(definition))
+		}
+	}
+}
+
+// Every operation of the OpenAPI document is served by the route it documents, and its body matches the command's arguments
+func TestOpenAPIMatchesRoutesAndCommands(t *testing.T) {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := document["components"].(ui.JSON)["schemas"].(ui.JSON)
+
+	operations := 0
+	for path, item := range document["paths"].(ui.JSON) {
+		for method, raw := range item.(ui.JSON) {
+			operation := raw.(ui.JSON)
+			action := operation["x-isaiah-action"].(string)
+			operations++
+
+			// The router resolves the documented path to the documented action
+			url := APIPrefix + strings.TrimPrefix(strings.ReplaceAll(path, "{id}", "some-id"), "/")
+			request, err := parseAPIRequest(httptest.NewRequest(strings.ToUpper(method), url, nil))
+			if err != nil {
+				t.Errorf("%s %s -> %s", method, path, err)
+				continue
+			}
+
+			route, status := findAPIRoute(request)
+			if route == nil {
+				t.Errorf("%s %s is documented, but isn't served (%d)", method, path, status)
+				continue
+			}
+			if route.Action != action {
+				t.Errorf("%s %s is documented as %s, but is served as %s", method, path, action, route.Action)
+			}
+			if role := operation["x-isaiah-role"]; role != RequiredRole(route.Action) {
+				t.Errorf("%s %s is documented as requiring %v, but requires %s", method, path, role, RequiredRole(route.Action))
+			}
+
+			// The documented body has the same fields, and types, as the websocket command's arguments (if any)
+			definition, exists := FindCommand(action)
+			if !exists || reflect.TypeOf(definition.Args) == reflect.TypeOf(noArgs{}) || reflect.TypeOf(definition.Args) == reflect.TypeOf(resourceArgs{}) {
+				continue
+			}
+
+			documented := ui.JSON{}
+			if body, exists := operation["requestBody"]; exists {
+				reference := body.(ui.JSON)["content"].(ui.JSON)["application/json"].(ui.JSON)["schema"].(ui.JSON)["$ref"].(string)
+				schema := schemas[strings.TrimPrefix(reference, "#/components/schemas/")].(ui.JSON)
+				documented = schema["properties"].(ui.JSON)
+			}
+
+			arguments := reflect.TypeOf(definition.Args)
+			for i := 0; i < arguments.NumField(); i++ {
+				field := arguments.Field(i)
+				if field.Name == "Resource" {
+					continue
+				}
+
+				property, exists := documented[field.Name].(ui.JSON)
+				if !exists {
+					t.Errorf("%s %s doesn't document the argument %s of %s", method, path, field.Name, action)
+					continue
+				}
+
+				expected, _ := apiSchema(field.Type, ui.JSON{})
+				if property["type"] != expected["type"] {
+					t.Errorf("%s %s documents %s as %v, but %s declares it as %v", method, path, field.Name, property["type"], action, expected["type"])
+				}
+			}
+		}
+	}
+
+	if operations != len(apiRoutes) {
+		t.Errorf("Expected %d documented operations, got %d", len(apiRoutes), operations)
+	}
+}
+
+// Every route requires an explicit role, rather than the highest one by default
+func TestRoutesHaveExplicitRoles(t *testing.T) {
+	for _, route := range apiRoutes {
+		if _, exists := FindCommand(route.Action); exists {
+			continue
+		}
+		if _, exists := apiActionsRoles[route.Action]; !exists {
+			t.Errorf("%s %s serves %s, which has no explicit role", route.Method, route.Resource, route.Action)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+)
+
+// Determine whether a websocket upgrade or a REST API call may proceed, based on its Origin header
+// - Requests without an Origin header (agents, command-line clients) are accepted, as browsers always send one
+// - Same-origin requests are always accepted
+// - Cross-origin requests are accepted only when listed in SERVER_ALLOWED_ORIGINS ("*" accepts all)
+func IsOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range strings.Split(_os.GetEnv("SERVER_ALLOWED_ORIGINS"), ",") {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed == "" {
+			continue
+		}
+
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	log.Printf("Refused cross-origin request from %s (origin: %q, host: %q)", requestAddress(r), origin, r.Host)
+	return false
+}
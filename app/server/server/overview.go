@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	_client "will-moss/isaiah/server/_internal/client"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Maximum duration of the queries sent to a single Docker host while building an overview
+const overviewHostTimeout = 10 * time.Second
+
+// Duration during which a host's overview is reused, so that opening the overview repeatedly doesn't hammer the hosts
+const overviewCacheDuration = 15 * time.Second
+
+// Most recent overview of every host, by host definition
+var overviewCache struct {
+	mutex   sync.Mutex
+	entries map[string]overviewCacheEntry
+}
+
+type overviewCacheEntry struct {
+	instance  ui.OverviewInstance
+	checkedAt time.Time
+}
+
+// Query the daemon's info, resources, and disk usage (the latter being omitted when it isn't reported in time)
+func collectOverviewInstance(docker *client.Client) ui.OverviewInstance {
+	ctx, cancel := context.WithTimeout(context.Background(), overviewHostTimeout)
+	defer cancel()
+
+	instance := ui.OverviewInstance{Docker: ui.OverviewDocker{Host: _client.Address(docker)}}
+
+	info, err := docker.Info(ctx)
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+
+	instance.Server.CountCPU = info.NCPU
+	instance.Server.AmountRAM = uint64(info.MemTotal)
+	instance.Docker.Version = info.ServerVersion
+	instance.Docker.OperatingSystem = info.OperatingSystem
+	instance.Docker.KernelVersion = info.KernelVersion
+	instance.Docker.StorageDriver = info.Driver
+
+	instance.Resources.Containers = ui.JSON{
+		"Count":   info.Containers,
+		"Running": info.ContainersRunning,
+		"Paused":  info.ContainersPaused,
+		"Stopped": info.ContainersStopped,
+	}
+	instance.Resources.Images = ui.JSON{"Count": info.Images}
+
+	volumes, err := docker.VolumeList(ctx, volume.ListOptions{})
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+	instance.Resources.Volumes = ui.JSON{"Count": len(volumes.Volumes)}
+
+	networks, err := docker.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		instance.Error = err.Error()
+		return instance
+	}
+	instance.Resources.Networks = ui.JSON{"Count": len(networks)}
+
+	// Disk usage : Can be slow on large hosts, hence optional
+	if usage, err := docker.DiskUsage(ctx, types.DiskUsageOptions{}); err == nil {
+		disk := ui.OverviewDiskUsage{Images: usage.LayersSize}
+		for _, c := range usage.Containers {
+			disk.Containers += c.SizeRw
+		}
+		for _, v := range usage.Volumes {
+			if v.UsageData != nil && v.UsageData.Size > 0 {
+				disk.Volumes += v.UsageData.Size
+			}
+		}
+		for _, b := range usage.BuildCache {
+			if !b.Shared {
+				disk.BuildCache += b.Size
+			}
+		}
+		disk.Total = disk.Images + disk.Containers + disk.Volumes + disk.BuildCache
+
+		instance.Resources.DiskUsage = &disk
+	}
+
+	return instance
+}
+
+// Retrieve the overview of a host, querying it again when the cached one is outdated
+// The key must change whenever the host's definition does (e.g. its address)
+func cachedOverviewInstance(key string, docker *client.Client) ui.OverviewInstance {
+	overviewCache.mutex.Lock()
+	entry, exists := overviewCache.entries[key]
+	overviewCache.mutex.Unlock()
+
+	if exists && time.Since(entry.checkedAt) <= overviewCacheDuration {
+		return entry.instance
+	}
+
+	instance := collectOverviewInstance(docker)
+
+	overviewCache.mutex.Lock()
+	defer overviewCache.mutex.Unlock()
+
+	if overviewCache.entries == nil {
+		overviewCache.entries = make(map[string]overviewCacheEntry)
+	}
+	overviewCache.entries[key] = overviewCacheEntry{instance: instance, checkedAt: time.Now()}
+
+	return instance
+}
+
+// Build the overview of the given hosts, in parallel
+// Hosts marked offline are reported as such right away, rather than waiting for them to time out
+func (server *Server) overviewHosts(hosts HostsArray) ui.OverviewInstanceArray {
+	server.hostMutex.RLock()
+	offline := make(map[string]string, len(server.offlineHosts))
+	for name, reason := range server.offlineHosts {
+		offline[name] = reason
+	}
+	server.hostMutex.RUnlock()
+
+	instances := make(ui.OverviewInstanceArray, len(hosts))
+
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var instance ui.OverviewInstance
+			if reason, isOffline := offline[h[0]]; isOffline {
+				instance = ui.OverviewInstance{Docker: ui.OverviewDocker{Host: h[1]}, Error: "The host is offline -> " + reason}
+			} else if docker, err := server.Clients.Get(h); err != nil {
+				instance = ui.OverviewInstance{Docker: ui.OverviewDocker{Host: h[1]}, Error: err.Error()}
+			} else {
+				instance = cachedOverviewInstance(strings.Join(h, " "), docker)
+			}
+
+			instance.Server.Name = h[0]
+			instance.Server.Host = h[1]
+			instance.Server.Role = "Master"
+			instances[i] = instance
+		}()
+	}
+	wg.Wait()
+
+	return instances
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	"will-moss/isaiah/server/ui"
+)
+
+// Represent an authorization policy, restricting the hosts and agents its subjects may access
+// - Subjects are matched by account name (Users) or by role (Roles), "*" matching everyone
+// - Hosts and Agents list what is allowed, "*" allowing all of them, and "Master" referring to the Master node
+// - When a user matches several policies, everything allowed by any of them is allowed
+// - When a user matches no policy, they can't access any host or agent
+type Policy struct {
+	Name   string
+	Users  []string
+	Roles  []string
+	Hosts  []string
+	Agents []string
+}
+
+// Represent an array of authorization policies
+type PoliciesArray []Policy
+
+// Read and validate the policies stored in the given file (JSON array)
+func LoadPolicies(path string) (PoliciesArray, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies PoliciesArray
+	if err := json.Unmarshal(raw, &policies); err != nil {
+		return nil, fmt.Errorf("%s file isn't properly formatted -> %s", path, err)
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("%s file doesn't contain any policy, which would deny access to everyone", path)
+	}
+
+	for i, p := range policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s file contains a policy without a name (position %d)", path, i+1)
+		}
+		if len(p.Users) == 0 && len(p.Roles) == 0 {
+			return nil, fmt.Errorf("%s file contains a policy without any user or role -> %s", path, p.Name)
+		}
+		for _, role := range p.Roles {
+			if role != "*" && !slices.Contains(rolesHierarchy, role) {
+				return nil, fmt.Errorf("%s file contains an invalid role for %s -> %s", path, p.Name, role)
+			}
+		}
+	}
+
+	return policies, nil
+}
+
+// Determine whether the given list contains the given entry, or the "*" wildcard
+func matchesEntry(list []string, entry string) bool {
+	return slices.Contains(list, "*") || slices.Contains(list, entry)
+}
+
+// Retrieve the policies applying to the given account
+func (policies PoliciesArray) For(user string, role string) PoliciesArray {
+	matching := make(PoliciesArray, 0)
+
+	for _, p := range policies {
+		if matchesEntry(p.Users, user) || matchesEntry(p.Roles, role) {
+			matching = append(matching, p)
+		}
+	}
+
+	return matching
+}
+
+// Determine whether the policies allow the given host, on the Master node (none of them allowing nothing)
+func (policies PoliciesArray) AllowsHost(host string) bool {
+	return slices.ContainsFunc(policies, func(p Policy) bool { return matchesEntry(p.Hosts, host) })
+}
+
+// Determine whether the policies allow the given agent ("Master" for the Master node, none of them allowing nothing)
+func (policies PoliciesArray) AllowsAgent(agent string) bool {
+	return slices.ContainsFunc(policies, func(p Policy) bool { return matchesEntry(p.Agents, agent) })
+}
+
+// Retrieve the policies applying to the session's user, and whether the user is restricted by them at all
+// Policies are enforced on Master only, agents trust the commands it forwards them
+func (server *Server) sessionPolicies(session _session.GenericSession) (PoliciesArray, bool) {
+	if _os.GetEnv("POLICIES_ENABLED") != "TRUE" || _os.GetEnv("SERVER_ROLE") != "Master" {
+		return nil, false
+	}
+
+	// Unauthenticated clients may access nothing until they log in
+	if authenticated, _ := session.Get("authenticated"); authenticated != true {
+		return PoliciesArray{}, true
+	}
+
+	user, _ := session.Get("user")
+	role, _ := session.Get("role")
+
+	name, _ := user.(string)
+	granted, _ := role.(string)
+
+	return server.Policies.For(name, granted), true
+}
+
+// Determine whether the session's user may run the given command, on its target host and agent
+func (server *Server) isPermittedByPolicies(session _session.GenericSession, command ui.Command) bool {
+	// Authentication commands on Master are always permitted (e.g. logging out)
+	if strings.HasPrefix(command.Action, "auth") && command.Agent == "" {
+		return true
+	}
+
+	// Agents' own commands (registering, replying) concern their connection, rather than a host or an agent
+	if _, isAgent := session.Get("agent"); isAgent || command.Action == "agent.register" {
+		return true
+	}
+
+	// Unauthenticated clients are handled by the authentication, which refuses everything else
+	if authenticated, _ := session.Get("authenticated"); authenticated != true {
+		return true
+	}
+
+	policies, restricted := server.sessionPolicies(session)
+	if !restricted {
+		return true
+	}
+
+	agent := command.Agent
+	if agent == "" {
+		agent = "Master"
+	}
+	if !policies.AllowsAgent(agent) {
+		return false
+	}
+
+	// Hosts are known by Master only, commands forwarded to agents target the agents' own Docker host
+	if command.Agent == "" && _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
+		host := command.Host
+		if host == "" {
+			host, _ = server.CurrentHost()
+		}
+
+		if !policies.AllowsHost(host) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Retrieve the names of the hosts the session's user may access
+func (server *Server) permittedHosts(session _session.GenericSession) []string {
+	policies, restricted := server.sessionPolicies(session)
+
+	return slices.DeleteFunc(server.KnownHosts().ToStrings(), func(h string) bool { return restricted && !policies.AllowsHost(h) })
+}
+
+// Retrieve the names of the agents the session's user may access
+func (server *Server) permittedAgents(session _session.GenericSession) []string {
+	policies, restricted := server.sessionPolicies(session)
+
+	return slices.DeleteFunc(server.KnownAgents().ToStrings(), func(a string) bool { return restricted && !policies.AllowsAgent(a) })
+}
+
+// Determine whether the session belongs to an authenticated client (rather than an agent, or a client yet to log in)
+func isAuthenticatedClient(session _session.GenericSession) bool {
+	if _, isAgent := session.Get("agent"); isAgent {
+		return false
+	}
+
+	authenticated, _ := session.Get("authenticated")
+	return authenticated == true
+}
+
+// Notify all the clients about the current list of agents, each of them seeing only the agents they may access
+func (server *Server) BroadcastAgents() {
+	sessions, _ := server.Melody.Sessions()
+	for _, s := range sessions {
+		if !isAuthenticatedClient(s) {
+			continue
+		}
+
+		notification := ui.NotificationData(ui.NotificationParams{Content: ui.JSON{
+			"Agents":       server.permittedAgents(s),
+			"AgentsStatus": server.permittedAgentsStatus(s),
+		}})
+		s.Write(notification.ToBytes())
+	}
+}
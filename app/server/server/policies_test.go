@@ -0,0 +1,55 @@
+package server
+
+import (
+	"testing"
+	"will-moss/isaiah/server/ui"
+)
+
+// Clients yet to log in see no agent when policies are enabled, and logged-in clients see those they may access
+func TestPermittedAgents(t *testing.T) {
+	t.Setenv("SERVER_ROLE", "Master")
+	t.Setenv("POLICIES_ENABLED", "TRUE")
+
+	server := newTestServer()
+	server.Policies = PoliciesArray{{Name: "edge", Users: []string{"alice"}, Agents: []string{"edge"}}}
+	server.registerAgent(Agent{Name: "edge"})
+	server.registerAgent(Agent{Name: "core"})
+
+	session := newTestSession()
+	session.Set("authenticated", false)
+	if agents := server.permittedAgents(session); len(agents) != 0 {
+		t.Errorf("Expected no agent for an unauthenticated client, got %v", agents)
+	}
+
+	session.Set("authenticated", true)
+	session.Set("user", "alice")
+	if agents := server.permittedAgents(session); len(agents) != 1 || agents[0] != "edge" {
+		t.Errorf("Expected only the permitted agent, got %v", agents)
+	}
+}
+
+// Agents register and reply to Master whatever the policies of the account they use
+func TestAgentsBypassPolicies(t *testing.T) {
+	t.Setenv("SERVER_ROLE", "Master")
+	t.Setenv("POLICIES_ENABLED", "TRUE")
+
+	server := newTestServer()
+	server.Policies = PoliciesArray{{Name: "edge", Users: []string{"alice"}, Agents: []string{"edge"}}}
+
+	session := newTestSession()
+	session.Set("user", "master")
+	if !server.isPermittedByPolicies(session, ui.Command{Action: "agent.register"}) {
+		t.Error("Expected an agent to register, whatever the policies")
+	}
+
+	session.Set("agent", Agent{Name: "edge"})
+	if !server.isPermittedByPolicies(session, ui.Command{Action: "agent.reply"}) {
+		t.Error("Expected an agent to reply, whatever the policies")
+	}
+
+	client := newTestSession()
+	client.Set("user", "master")
+	if server.isPermittedByPolicies(client, ui.Command{Action: "container.list"}) {
+		t.Error("Expected a client to be restricted by the policies")
+	}
+}
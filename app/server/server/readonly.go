@@ -0,0 +1,41 @@
+package server
+
+import (
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	"will-moss/isaiah/server/ui"
+)
+
+// Determine whether the given action modifies Docker resources, or runs anything on the hosting system
+func IsMutating(action string) bool {
+	if definition, exists := FindCommand(strings.TrimPrefix(action, "api.")); exists {
+		return definition.Mutating
+	}
+
+	return RequiredRole(action) != RoleViewer
+}
+
+// Determine whether the given action is refused because of the global read-only mode
+func isRefusedByReadOnly(action string) bool {
+	return _os.GetEnv("READ_ONLY") == "TRUE" && IsMutating(action)
+}
+
+// Remove from the given menu the actions that the session isn't allowed to run
+// (either because of the user's role, or because of the global read-only mode)
+func (server *Server) allowedActions(session _session.GenericSession, actions []ui.MenuAction) []ui.MenuAction {
+	allowed := make([]ui.MenuAction, 0, len(actions))
+
+	for _, action := range actions {
+		if isRefusedByReadOnly(action.Command) {
+			continue
+		}
+		if !server.IsAllowed(session, action.Command) {
+			continue
+		}
+
+		allowed = append(allowed, action)
+	}
+
+	return allowed
+}
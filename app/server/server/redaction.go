@@ -0,0 +1,82 @@
+package server
+
+import (
+	"log"
+	"strings"
+	_os "will-moss/isaiah/server/_internal/os"
+	"will-moss/isaiah/server/_internal/redact"
+	"will-moss/isaiah/server/ui"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Suffix of the actions that reveal the values normally redacted (e.g. container.inspect.env.reveal)
+const revealSuffix = ".reveal"
+
+// Retrieve the redaction rules, and whether the given action must apply them
+// Actions ending with ".reveal" skip redaction (their role is checked like any other action's)
+func redactionRules(action string) (redact.Rules, bool) {
+	if _os.GetEnv("REDACTION_ENABLED") != "TRUE" || strings.HasSuffix(action, revealSuffix) {
+		return redact.Rules{}, false
+	}
+
+	rules, err := redact.Compile(_os.GetEnv("REDACTION_NAME_PATTERNS"), _os.GetEnv("REDACTION_VALUE_PATTERNS"))
+	if err != nil {
+		log.Printf("Error loading the redaction rules -> %s", err)
+	}
+
+	return rules, true
+}
+
+// Determine whether the given action reveals the values normally redacted
+func isRevealing(action string) bool {
+	return strings.HasSuffix(action, revealSuffix)
+}
+
+// Redact the values of the given inspector rows (one name-value pair per row, as in the Env tab)
+func redactRows(rules redact.Rules, rows ui.Rows) ui.Rows {
+	redacted := make(ui.Rows, 0, len(rows))
+
+	for _, row := range rows {
+		copied := make(ui.Row)
+		for key, value := range row {
+			copied[key] = value
+
+			if key == "_representation" {
+				continue
+			}
+
+			if v, ok := value.(string); ok && rules.IsSensitive(key, v) {
+				copied[key] = redact.Mask
+				copied["_representation"] = []string{key + ":", redact.Mask}
+			}
+		}
+
+		redacted = append(redacted, copied)
+	}
+
+	return redacted
+}
+
+// Redact the environment variables found in the JSON parts of the given inspector content (container's Config)
+func redactInspector(rules redact.Rules, content ui.InspectorContent) ui.InspectorContent {
+	redacted := make(ui.InspectorContent, 0, len(content))
+
+	for _, part := range content {
+		if j, ok := part.Content.(ui.JSON); ok && part.Type == "json" {
+			if config, ok := j["Config"].(*container.Config); ok && config != nil {
+				copied := *config
+				copied.Env = rules.Env(config.Env)
+				part.Content = ui.JSON{"Config": &copied}
+			}
+		}
+
+		if lines, ok := part.Content.([]string); ok && part.Type == "code" {
+			part.Content = strings.Split(rules.Text(strings.Join(lines, "\n")), "\n")
+		}
+
+		redacted = append(redacted, part)
+	}
+
+	return redacted
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	_session "will-moss/isaiah/server/_internal/session"
+)
+
+// Represent a session wrapping another one, for the duration of a command
+type wrappedSession interface {
+	Unwrap() _session.GenericSession
+}
+
+// Represent a session that remembers the Sequence of the command being run
+// Every notification sent through it carries that Sequence, so that clients sending several
+// commands at once can tell which reply belongs to which command
+type sequencedSession struct {
+	_session.GenericSession
+	sequence int32
+}
+
+// Retrieve the session that was wrapped
+func (s *sequencedSession) Unwrap() _session.GenericSession {
+	return s.GenericSession
+}
+
+// Retrieve the original session, behind all the wrappers (audit, sequence)
+func unwrapSession(session _session.GenericSession) _session.GenericSession {
+	for {
+		wrapper, ok := session.(wrappedSession)
+		if !ok {
+			return session
+		}
+		session = wrapper.Unwrap()
+	}
+}
+
+// Retrieve the Sequence of the command being run in the given session, if any
+func sessionSequence(session _session.GenericSession) int32 {
+	for {
+		if s, ok := session.(*sequencedSession); ok {
+			return s.sequence
+		}
+
+		wrapper, ok := session.(wrappedSession)
+		if !ok {
+			return 0
+		}
+		session = wrapper.Unwrap()
+	}
+}
@@ -1,14 +1,14 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"runtime"
+	"log"
 	"slices"
 	"strings"
-	_client "will-moss/isaiah/server/_internal/client"
+	"sync"
+	"time"
 	_io "will-moss/isaiah/server/_internal/io"
 	_os "will-moss/isaiah/server/_internal/os"
 	_session "will-moss/isaiah/server/_internal/session"
@@ -29,7 +29,25 @@ type Server struct {
 	Docker          *client.Client
 	Agents          AgentsArray
 	Hosts           HostsArray
+	Users           UsersArray
+	Policies        PoliciesArray
+	Throttle        LoginThrottle
+	Tokens          SessionTokens
+	Audit           AuditLog
+	TwoFactor       TwoFactor
+	SingleSignOn    SingleSignOn
+	APITokens       APITokens
+	APIReplies      APIReplies
+	Metrics         Metrics
+	Clients         DockerClients
+	Heartbeats      AgentHeartbeats
+	Forwards        AgentForwards
 	CurrentHostName string
+
+	hostMutex      sync.RWMutex      // Guards Hosts, Docker and CurrentHostName (the default host), and offlineHosts
+	offlineHosts   map[string]string // Name -> Error of the last check
+	hostsFileMutex sync.Mutex        // Serializes the additions / removals of hosts
+	agentMutex     sync.RWMutex      // Guards Agents
 }
 
 // Represent a command handler, used only _internally
@@ -45,6 +63,11 @@ func (server *Server) send(session _session.GenericSession, message []byte) {
 
 // Send a notification
 func (server *Server) SendNotification(session _session.GenericSession, notification ui.Notification) {
+	// Let the client know which of their commands the notification answers
+	if notification.Sequence == 0 {
+		notification.Sequence = sessionSequence(session)
+	}
+
 	// If configured, don't show confirmations
 	if slices.Contains([]string{ui.TypeInfo, ui.TypeSuccess}, notification.Type) {
 		notification.Display = _os.GetEnv("DISPLAY_CONFIRMATIONS") == "TRUE"
@@ -66,6 +89,7 @@ func (server *Server) SendNotification(session _session.GenericSession, notifica
 				"To":           initiator.(string),
 				"Notification": notification,
 			},
+			Sequence: notification.Sequence,
 		}
 
 		server.send(session, command.ToBytes())
@@ -78,19 +102,22 @@ func (server *Server) SendNotification(session _session.GenericSession, notifica
 
 // Same as handler.RunCommand
 func (server *Server) runCommand(session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	switch command.Action {
 	case "init", "enumerate":
 		var tabs []ui.Tab
 
 		tabs_enabled := strings.Split(strings.ToLower(_os.GetEnv("TABS_ENABLED")), ",")
 
-		containers := resources.ContainersList(server.Docker, filters.Args{})
-		images := resources.ImagesList(server.Docker)
-		volumes := resources.VolumesList(server.Docker)
-		networks := resources.NetworksList(server.Docker)
-		stacks := resources.StacksList(server.Docker)
-		agents := server.Agents.ToStrings()
-		hosts := server.Hosts.ToStrings()
+		containers := resources.ContainersList(docker, filters.Args{})
+		images := resources.ImagesList(docker)
+		volumes := resources.VolumesList(docker)
+		networks := resources.NetworksList(docker)
+		stacks := resources.StacksList(docker)
+		agents := server.permittedAgents(session)
+		hosts := server.permittedHosts(session)
+		offlineHosts := slices.DeleteFunc(server.OfflineHosts(), func(h string) bool { return !slices.Contains(hosts, h) })
 
 		if len(stacks) > 0 {
 			columns := strings.Split(_os.GetEnv("COLUMNS_STACKS"), ",")
@@ -144,9 +171,11 @@ func (server *Server) runCommand(session _session.GenericSession, command ui.Com
 					session,
 					ui.NotificationInit(ui.NotificationParams{
 						Content: ui.JSON{
-							"Tabs":   tabs,
-							"Agents": agents,
-							"Hosts":  hosts,
+							"Tabs":         tabs,
+							"Agents":       agents,
+							"AgentsStatus": server.permittedAgentsStatus(session),
+							"Hosts":        hosts,
+							"OfflineHosts": offlineHosts,
 						},
 					}))
 			} else if command.Action == "enumerate" {
@@ -167,9 +196,11 @@ func (server *Server) runCommand(session _session.GenericSession, command ui.Com
 					session,
 					ui.NotificationInit(ui.NotificationParams{
 						Content: ui.JSON{
-							"Agents":     agents,
-							"Hosts":      hosts,
-							"ChunkIndex": -1,
+							"Agents":       agents,
+							"AgentsStatus": server.permittedAgentsStatus(session),
+							"Hosts":        hosts,
+							"OfflineHosts": offlineHosts,
+							"ChunkIndex":   -1,
 						},
 					}))
 
@@ -273,7 +304,7 @@ func (server *Server) runCommand(session _session.GenericSession, command ui.Com
 
 	// Command : Run a command inside the currently-opened shell (can be a container shell, or a system shell)
 	case "shell.command":
-		command := command.Args["Command"].(string)
+		command, _ := command.Args["Command"].(string)
 		shouldQuit := command == "exit"
 		terminal, exists := session.Get("tty")
 
@@ -304,89 +335,24 @@ func (server *Server) runCommand(session _session.GenericSession, command ui.Com
 			serverName = _os.GetEnv("AGENT_NAME")
 		}
 
-		// Case when : Standalone
-		if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" && len(server.Agents) == 0 {
-			dockerVersion, _ := server.Docker.ServerVersion(context.Background())
-			instance := ui.OverviewInstance{
-				Server: ui.OverviewServer{
-					CountCPU:  runtime.NumCPU(),
-					AmountRAM: _os.VirtualMemory().Total,
-					Name:      serverName,
-					Role:      _os.GetEnv("SERVER_ROLE"),
-				},
-				Docker: ui.OverviewDocker{
-					Version: dockerVersion.Version,
-					Host:    server.Docker.DaemonHost(),
-				},
-				Resources: ui.OverviewResources{
-					Containers: ui.JSON{"Count": resources.ContainersCount(server.Docker)},
-					Images:     ui.JSON{"Count": resources.ImagesCount(server.Docker)},
-					Volumes:    ui.JSON{"Count": resources.VolumesCount(server.Docker)},
-					Networks:   ui.JSON{"Count": resources.NetworksCount(server.Docker)},
-				},
-			}
-			overview.Instances = append(overview.Instances, instance)
-		} else if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" && len(server.Agents) > 0 {
-			// Case when : Multi-agent
-
-			// First : Append current server
-			dockerVersion, _ := server.Docker.ServerVersion(context.Background())
-			instance := ui.OverviewInstance{
-				Server: ui.OverviewServer{
-					CountCPU:  runtime.NumCPU(),
-					AmountRAM: _os.VirtualMemory().Total,
-					Name:      serverName,
-					Role:      _os.GetEnv("SERVER_ROLE"),
-					Agents:    server.Agents.ToStrings(),
-				},
-				Docker: ui.OverviewDocker{
-					Version: dockerVersion.Version,
-					Host:    server.Docker.DaemonHost(),
-				},
-				Resources: ui.OverviewResources{
-					Containers: ui.JSON{"Count": resources.ContainersCount(server.Docker)},
-					Images:     ui.JSON{"Count": resources.ImagesCount(server.Docker)},
-					Volumes:    ui.JSON{"Count": resources.VolumesCount(server.Docker)},
-					Networks:   ui.JSON{"Count": resources.NetworksCount(server.Docker)},
-				},
-			}
-			overview.Instances = append(overview.Instances, instance)
+		if _os.GetEnv("MULTI_HOST_ENABLED") != "TRUE" {
+			// Case when : Standalone, or Multi-agent
+			instance := cachedOverviewInstance("local", docker)
+			instance.Server.Name = serverName
+			instance.Server.Role = _os.GetEnv("SERVER_ROLE")
 
-			// After : Do nothing more, the client will request an overview from each agent
+			// When agents exist, the client will request an overview from each of them
+			if len(server.KnownAgents()) > 0 {
+				instance.Server.Agents = server.permittedAgents(session)
+			}
 
-		} else if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
+			overview.Instances = append(overview.Instances, instance)
+		} else {
 			// Case when : Multi-host
-			originalHost := server.CurrentHostName
-			for _, h := range server.Hosts {
-				server.SetHost(h[0])
-
-				dockerVersion, _ := server.Docker.ServerVersion(context.Background())
-				instance := ui.OverviewInstance{
-					Server: ui.OverviewServer{
-						Name: h[0],
-						Host: h[1],
-						Role: "Master",
-					},
-					Docker: ui.OverviewDocker{
-						Version: dockerVersion.Version,
-						Host:    server.Docker.DaemonHost(),
-					},
-					Resources: ui.OverviewResources{
-						Containers: ui.JSON{"Count": resources.ContainersCount(server.Docker)},
-						Images:     ui.JSON{"Count": resources.ImagesCount(server.Docker)},
-						Volumes:    ui.JSON{"Count": resources.VolumesCount(server.Docker)},
-						Networks:   ui.JSON{"Count": resources.NetworksCount(server.Docker)},
-					},
-				}
-
-				if strings.HasPrefix(h[1], "unix://") {
-					instance.Server.CountCPU = runtime.NumCPU()
-					instance.Server.AmountRAM = _os.VirtualMemory().Total
-				}
+			permitted := server.permittedHosts(session)
+			hosts := slices.DeleteFunc(server.KnownHosts(), func(h []string) bool { return !slices.Contains(permitted, h[0]) })
 
-				overview.Instances = append(overview.Instances, instance)
-			}
-			server.SetHost(originalHost)
+			overview.Instances = server.overviewHosts(hosts)
 		}
 
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Overview": overview}}))
@@ -409,6 +375,7 @@ func (server *Server) Handle(session _session.GenericSession, message ...[]byte)
 	// Dev-only : Set authenticated by default if authentication is disabled
 	if _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
 		session.Set("authenticated", true)
+		session.Set("role", RoleAdmin)
 	}
 
 	// On first connection
@@ -445,6 +412,30 @@ func (server *Server) Handle(session _session.GenericSession, message ...[]byte)
 		return
 	}
 
+	// A failing command must never bring the whole server down
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Command %s failed unexpectedly : %v", command.Action, r)
+			server.SendNotification(session, ui.NotificationError(ui.NP{
+				Content: ui.JSON{"Message": fmt.Sprintf("The command %s failed unexpectedly", command.Action)},
+			}))
+		}
+	}()
+
+	// Heartbeats are answered right away, leaving the state of the agent's clients (initiator, stream) untouched
+	if _os.GetEnv("SERVER_ROLE") == "Agent" && command.Action == "agent.ping" {
+		server.pong(session, command)
+		return
+	}
+
+	// Anything received from an agent proves it's alive
+	if agent, isAgent := session.Get("agent"); isAgent {
+		if server.Heartbeats.seen(agent.(Agent).Name) {
+			log.Printf("Agent %s is responsive again", agent.(Agent).Name)
+			server.BroadcastAgentsStatus()
+		}
+	}
+
 	// If the command is meant to be forwarded to the final client, locally store the "initiator" field
 	if _os.GetEnv("SERVER_ROLE") == "Agent" && command.Initiator != "" {
 		session.Set("initiator", command.Initiator)
@@ -453,17 +444,123 @@ func (server *Server) Handle(session _session.GenericSession, message ...[]byte)
 		// Why once again? Because now, we have an "initiator" field, so "authenticated" is per-client
 		if _os.GetEnv("AUTHENTICATION_ENABLED") != "TRUE" {
 			session.Set("authenticated", true)
+			session.Set("role", RoleAdmin)
 		}
 	}
 
+	// Tag every notification produced while running the command with its Sequence
+	if command.Sequence != 0 {
+		session = &sequencedSession{GenericSession: session, sequence: command.Sequence}
+	}
+
+	// Refuse unknown commands, and commands whose arguments don't fit their definition, before anything runs
+	definition, args, err := validateCommand(command)
+	if err != nil {
+		server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+		return
+	}
+	command.Args = args
+
+	// Commands Master sends to its agents on its own behalf are never accepted from clients
+	if _, isAgent := session.Get("agent"); _os.GetEnv("SERVER_ROLE") == "Master" && !isAgent && isMasterOriginated(command.Action) {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{Content: ui.JSON{"Message": fmt.Sprintf("This command is reserved to the Master node : %s", command.Action)}}),
+		)
+		return
+	}
+
 	// By default, prior to running any command, close the current stream if any's still open
 	if stream, exists := session.Get("stream"); exists {
 		(*stream.(*io.ReadCloser)).Close()
 		session.UnSet("stream")
 	}
 
+	// Ensure the client's address is allowed to run the command (clients and agents have their own rules)
+	if !isPeerAllowed(session, command.Action) {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("Your address isn't allowed to run this command : %s", command.Action),
+				},
+			}),
+		)
+		return
+	}
+
+	// Refuse every mutating command when read-only mode is enabled
+	if isRefusedByReadOnly(command.Action) {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("Isaiah is running in read-only mode, this command is unavailable : %s", command.Action),
+				},
+			}),
+		)
+		return
+	}
+
+	// Ensure the client's role permits the command (checked on Master before forwarding to any agent)
+	if authenticated, _ := session.Get("authenticated"); authenticated == true || command.Agent != "" {
+		if !server.IsAllowed(session, command.Action) {
+			server.SendNotification(
+				session,
+				ui.NotificationError(ui.NP{
+					Content: ui.JSON{
+						"Message": fmt.Sprintf("Your role doesn't allow you to run this command : %s", command.Action),
+					},
+				}),
+			)
+			return
+		}
+	}
+
+	// Ensure the command stays within the scopes of the API token used to authenticate, if any
+	if !server.isPermittedByToken(session, command) {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("Your API token doesn't allow this command : %s", command.Action),
+				},
+			}),
+		)
+		return
+	}
+
+	// When multi-host is enabled, and no host was specified, default to the session's host
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && command.Agent == "" && command.Host == "" {
+		command.Host = server.sessionHost(session)
+	}
+
+	// Ensure the client's account may access the command's target host and agent (authorization policies)
+	if !server.isPermittedByPolicies(session, command) {
+		server.SendNotification(
+			session,
+			ui.NotificationError(ui.NP{
+				Content: ui.JSON{
+					"Message": fmt.Sprintf("Your account isn't allowed to access this host or agent : %s", command.Action),
+				},
+			}),
+		)
+		return
+	}
+
 	// If the command is meant to be run by an agent, forward it, no further action
 	if _os.GetEnv("SERVER_ROLE") == "Master" && command.Agent != "" {
+		// The audit record is completed once the agent replies, or fails to
+		var record *AuditRecord
+		if isAudited(command.Action) {
+			created := newAuditRecord(session, command)
+			record = &created
+		}
+		if metricsEnabled() {
+			server.Metrics.RecordCommand(command.Action, OutcomeForwarded, 0)
+		}
+
+		forwarded := false
 		allSessions, _ := server.Melody.Sessions()
 		for index := range allSessions {
 			s := allSessions[index]
@@ -486,12 +583,29 @@ func (server *Server) Handle(session _session.GenericSession, message ...[]byte)
 			// Append initial client's id to enable reverse response routing (from agent to initial client)
 			command.Initiator = clientId.(string)
 
-			// Send the command to the agent
+			// Send the command to the agent, and expect a reply in time
 			s.Write(command.ToBytes())
+			if awaited := server.Forwards.add(agent.(Agent).Name, command, record); !awaited && record != nil {
+				record.Outcome = OutcomeForwarded
+				server.Audit.Append(*record)
+			}
+			forwarded = true
 
 			break
 		}
 
+		// The agent disconnected, or was evicted, since the client last heard of it
+		if !forwarded {
+			message := fmt.Sprintf("The agent %s isn't connected anymore", command.Agent)
+			if record != nil {
+				record.Outcome, record.Message = OutcomeError, message
+				server.Audit.Append(*record)
+			}
+
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": message}}))
+			return
+		}
+
 		// Let the client know the agent is processing their input
 		if !strings.HasPrefix(command.Action, "auth") {
 			server.SendNotification(session, ui.NotificationLoading())
@@ -499,63 +613,68 @@ func (server *Server) Handle(session _session.GenericSession, message ...[]byte)
 		return
 	}
 
-	// When multi-host is enabled, set the appropriate host before interacting with Docker
-	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" {
-		if command.Host != "" {
-			server.SetHost(command.Host)
+	// When multi-host is enabled, ensure the command's host exists, and remember it as the session's host
+	// The Docker client is then resolved per command (see ClientFor), leaving other sessions' commands unaffected
+	if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && command.Host != "" {
+		if _, err := server.HostClient(command.Host); err != nil {
+			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
+			return
 		}
+
+		session.Set("host", command.Host)
 	}
 
 	// # - Dispatch the command to the appropriate handler
 	var h handler
 
-	if authenticated, _ := session.Get("authenticated"); authenticated != true ||
-		strings.HasPrefix(command.Action, "auth") {
+	// + On agents, commands Master sends on its own behalf were authorized by Master already, and bypass authentication
+	trusted := _os.GetEnv("SERVER_ROLE") == "Agent" && isMasterOriginated(command.Action)
+
+	if authenticated, _ := session.Get("authenticated"); !trusted && (authenticated != true ||
+		strings.HasPrefix(command.Action, "auth")) {
 		h = Authentication{}
 	} else {
 		// Let the client know the server is processing their input
-		// + Disable sending "loading" notifications for agent nodes, as Master does it already
-		if _os.GetEnv("SERVER_ROLE") == "Master" {
+		// + Disable sending "loading" notifications for agent nodes, as Master does it already, and to agents
+		if _, isAgent := session.Get("agent"); _os.GetEnv("SERVER_ROLE") == "Master" && !isAgent {
 			server.SendNotification(session, ui.NotificationLoading())
 		}
 
-		switch true {
-		case strings.HasPrefix(command.Action, "image"):
-			h = Images{}
-		case strings.HasPrefix(command.Action, "container"):
-			h = Containers{}
-		case strings.HasPrefix(command.Action, "volume"):
-			h = Volumes{}
-		case strings.HasPrefix(command.Action, "network"):
-			h = Networks{}
-		case strings.HasPrefix(command.Action, "stack"):
-			h = Stacks{}
-		case strings.HasPrefix(command.Action, "agent"):
-			h = Agents{}
-		default:
-			h = nil
-		}
+		h = definition.Handler
+	}
+
+	// Keep track of the command's outcome when it must be audited, or measured
+	var record AuditRecord
+	_, isAuthentication := h.(Authentication)
+	audited := !isAuthentication && isAudited(command.Action)
+	measured := metricsEnabled()
+	if audited {
+		record = newAuditRecord(session, command)
+	}
+	if audited || measured {
+		session = &auditedSession{GenericSession: session}
 	}
 
+	start := time.Now()
 	if h != nil {
 		h.RunCommand(server, session, command)
 	} else {
 		server.runCommand(session, command)
 	}
+	duration := time.Since(start)
 
-}
+	if audited || measured {
+		outcome, message := session.(*auditedSession).Result()
 
-func (s *Server) SetHost(name string) {
-	var correspondingHost []string
-	for _, v := range s.Hosts {
-		if v[0] == name {
-			correspondingHost = v
-			break
+		if audited {
+			record.Outcome, record.Message = outcome, message
+			server.Audit.Append(record)
+		}
+		if measured {
+			server.Metrics.RecordCommand(command.Action, outcome, duration)
 		}
 	}
 
-	s.Docker = _client.NewClientWithOpts(client.WithHost(correspondingHost[1]))
-	s.CurrentHostName = name
 }
 
 func (s *Server) GetPreferences() ui.Preferences {
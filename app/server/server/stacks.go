@@ -7,6 +7,7 @@ import (
 	_io "will-moss/isaiah/server/_internal/io"
 	_os "will-moss/isaiah/server/_internal/os"
 	"will-moss/isaiah/server/_internal/process"
+	"will-moss/isaiah/server/_internal/redact"
 	_session "will-moss/isaiah/server/_internal/session"
 	"will-moss/isaiah/server/resources"
 	"will-moss/isaiah/server/ui"
@@ -18,6 +19,8 @@ import (
 type Stacks struct{}
 
 func (Stacks) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	if _os.GetEnv("DOCKER_RUNNING") == "TRUE" {
 		server.SendNotification(
 			session,
@@ -36,18 +39,18 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Default menu
 	case "stack.menu":
-		actions := resources.StackSingleActions()
+		actions := server.allowedActions(session, resources.StackSingleActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - Bulk menu
 	case "stacks.bulk":
-		actions := resources.StacksBulkActions()
+		actions := server.allowedActions(session, resources.StacksBulkActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - List
 	case "stacks.list":
 		columns := strings.Split(_os.GetEnv("COLUMNS_STACKS"), ",")
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		rows := stacks.ToRows(columns)
 		server.SendNotification(
@@ -59,7 +62,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Update
 	case "stacks.update":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -74,7 +77,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 			return
 		}
 
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		hasErrored := false
 		for _, stack := range stacks {
@@ -85,7 +88,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				}),
 			)
 
-			err := stack.Update(server.Docker)
+			err := stack.Update(docker)
 
 			if err != nil {
 				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -105,7 +108,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Restart
 	case "stacks.restart":
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		hasErrored := false
 		for _, stack := range stacks {
@@ -116,7 +119,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				}),
 			)
 
-			err := stack.Restart(server.Docker)
+			err := stack.Restart(docker)
 
 			if err != nil {
 				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -136,7 +139,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Pause
 	case "stacks.pause":
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		hasEvenStarted := false
 		hasErrored := false
@@ -154,7 +157,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				}),
 			)
 
-			err := stack.Pause(server.Docker)
+			err := stack.Pause(docker)
 
 			if err != nil {
 				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -181,7 +184,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Unpause
 	case "stacks.unpause":
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		hasEvenStarted := false
 		hasErrored := false
@@ -199,7 +202,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				}),
 			)
 
-			err := stack.Unpause(server.Docker)
+			err := stack.Unpause(docker)
 
 			if err != nil {
 				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -226,7 +229,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Bulk - Down
 	case "stacks.down":
-		stacks := resources.StacksList(server.Docker)
+		stacks := resources.StacksList(docker)
 
 		hasErrored := false
 		for _, stack := range stacks {
@@ -237,7 +240,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				}),
 			)
 
-			err := stack.Down(server.Docker)
+			err := stack.Down(docker)
 
 			if err != nil {
 				server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -257,7 +260,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Up
 	case "stack.up":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -280,7 +283,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 			break
 		}
 
-		err := stack.Up(server.Docker)
+		err := stack.Up(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -302,10 +305,10 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 		var err error
 		var newState string
 		if strings.HasPrefix(stack.Status, "paused") {
-			err = stack.Unpause(server.Docker)
+			err = stack.Unpause(docker)
 			newState = "unpaused"
 		} else {
-			err = stack.Pause(server.Docker)
+			err = stack.Pause(docker)
 			newState = "paused"
 		}
 
@@ -330,7 +333,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 			break
 		}
 
-		err := stack.Down(server.Docker)
+		err := stack.Down(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -354,7 +357,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 			break
 		}
 
-		err := stack.Stop(server.Docker)
+		err := stack.Stop(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -370,7 +373,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Update
 	case "stack.update":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -387,7 +390,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
-		err := stack.Update(server.Docker)
+		err := stack.Update(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -405,7 +408,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 	case "stack.restart":
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
-		err := stack.Restart(server.Docker)
+		err := stack.Restart(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -421,7 +424,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Create
 	case "stack.create":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -464,11 +467,11 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Single - Retrieve configuration for editing it client-side
 	case "stack.edit.prepare":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -485,13 +488,18 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
-		config, err := stack.GetRawConfig(server.Docker)
+		config, err := stack.GetRawConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
 		}
 
+		// Hide the sensitive values, they're put back when the edited file is submitted
+		if rules, enabled := redactionRules(command.Action); enabled {
+			config = rules.Text(config)
+		}
+
 		server.SendNotification(
 			session,
 			ui.NotificationPrompt(ui.NP{
@@ -510,7 +518,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Edit a stack (down, overwrite, up)
 	case "stack.edit":
-		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(server.Docker.DaemonHost(), "unix://") {
+		if _os.GetEnv("MULTI_HOST_ENABLED") == "TRUE" && !strings.HasPrefix(docker.DaemonHost(), "unix://") {
 			server.SendNotification(
 				session,
 				ui.NotificationError(ui.NP{
@@ -528,6 +536,13 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
 
+		// Put back the sensitive values that were redacted when the file was prepared
+		if content, ok := command.Args["Content"].(string); ok && strings.Contains(content, redact.Mask) {
+			if original, err := stack.GetRawConfig(docker); err == nil {
+				command.Args["Content"] = redact.Restore(content, original)
+			}
+		}
+
 		task := process.LongTask{
 			Function: stack.Edit,
 			Args:     command.Args, // Expects : { "Content": <string> }
@@ -556,7 +571,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 				)
 			},
 		}
-		task.RunSync(server.Docker)
+		task.RunSync(docker)
 
 	// Single - Get inspector tabs
 	case "stack.inspect.tabs":
@@ -572,7 +587,7 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 	case "stack.inspect.services":
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
-		services, err := stack.GetServices(server.Docker)
+		services, err := stack.GetServices(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -591,16 +606,20 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 		)
 
 	// Single - Inspect full configuration
-	case "stack.inspect.config":
+	case "stack.inspect.config", "stack.inspect.config.reveal":
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
-		config, err := stack.GetConfig(server.Docker)
+		config, err := stack.GetConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
 		}
 
+		if rules, enabled := redactionRules(command.Action); enabled {
+			config = redactInspector(rules, config)
+		}
+
 		server.SendNotification(
 			session,
 			ui.NotificationData(ui.NP{
@@ -614,12 +633,15 @@ func (Stacks) RunCommand(server *Server, session _session.GenericSession, comman
 
 	// Single - Inspect logs
 	case "stack.inspect.logs":
-		var showTimestamps = command.Args["showTimestamps"].(bool)
+		var args logsArgs
+		mapstructure.Decode(command.Args, &args)
+
+		var showTimestamps = args.ShowTimestamps
 		var stack resources.Stack
 		mapstructure.Decode(command.Args["Resource"], &stack)
 
 		stream, err := stack.GetLogs(
-			server.Docker,
+			docker,
 			_io.CustomWriter{WriteFunction: func(p []byte) {
 				server.SendNotification(
 					session,
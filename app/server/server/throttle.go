@@ -0,0 +1,170 @@
+package server
+
+import (
+	"math"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+	_strconv "will-moss/isaiah/server/_internal/strconv"
+
+	"github.com/olahol/melody"
+)
+
+// Represent the failed login attempts made from a single remote address
+type loginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	BlockedTill time.Time
+}
+
+// Maximum delay imposed between two attempts once too many failed across all addresses
+// Kept short, as it applies to everyone : it slows distributed attacks down, without locking legitimate users out
+const globalBackoffCap = 30 * time.Second
+
+// Represent the login brute-force protection state, per remote address and globally
+type LoginThrottle struct {
+	mutex     sync.Mutex
+	addresses map[string]*loginAttempts
+	failures  []time.Time // Timestamps of all the recent failed attempts, for global throttling
+}
+
+// Retrieve the duration of the lockout window, from the LOGIN_LOCKOUT_DURATION setting
+func lockoutDuration() time.Duration {
+	return time.Duration(_strconv.ParseInt(_os.GetEnv("LOGIN_LOCKOUT_DURATION"), 10, 64)) * time.Second
+}
+
+// Remove the records that are older than the lockout window
+func (t *LoginThrottle) cleanup(now time.Time) {
+	window := lockoutDuration()
+
+	for address, attempts := range t.addresses {
+		if now.Sub(attempts.LastFailure) > window && now.After(attempts.BlockedTill) {
+			delete(t.addresses, address)
+		}
+	}
+
+	recent := make([]time.Time, 0, len(t.failures))
+	for _, f := range t.failures {
+		if now.Sub(f) <= window {
+			recent = append(recent, f)
+		}
+	}
+	t.failures = recent
+}
+
+// Compute the delay imposed after the last failed attempt, from any address (must be called with the mutex held)
+// Once LOGIN_GLOBAL_MAX_ATTEMPTS attempts failed within the lockout window, the delay starts from LOGIN_BACKOFF_DELAY,
+// and doubles with every further failure, up to globalBackoffCap
+func (t *LoginThrottle) globalBackoff() time.Duration {
+	globalMax := int(_strconv.ParseInt(_os.GetEnv("LOGIN_GLOBAL_MAX_ATTEMPTS"), 10, 64))
+	if globalMax <= 0 || len(t.failures) < globalMax {
+		return 0
+	}
+
+	delay := time.Duration(_strconv.ParseInt(_os.GetEnv("LOGIN_BACKOFF_DELAY"), 10, 64)) * time.Second
+	backoff := time.Duration(float64(delay) * math.Pow(2, float64(min(len(t.failures)-globalMax, 16))))
+
+	return min(backoff, globalBackoffCap)
+}
+
+// Determine how long the given address must wait before attempting to log in again
+// Returns zero when a new attempt is permitted
+func (t *LoginThrottle) Wait(address string) time.Duration {
+	if _os.GetEnv("LOGIN_THROTTLING_ENABLED") != "TRUE" {
+		return 0
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.cleanup(now)
+
+	// Per-address lockout / back-off
+	if attempts, ok := t.addresses[address]; ok && now.Before(attempts.BlockedTill) {
+		return attempts.BlockedTill.Sub(now)
+	}
+
+	// Global back-off, when too many attempts failed across all addresses
+	if backoff := t.globalBackoff(); backoff > 0 {
+		if wait := t.failures[len(t.failures)-1].Add(backoff).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// Record a failed attempt from the given address, and compute its next back-off delay
+func (t *LoginThrottle) Fail(address string) {
+	if _os.GetEnv("LOGIN_THROTTLING_ENABLED") != "TRUE" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.addresses == nil {
+		t.addresses = make(map[string]*loginAttempts)
+	}
+
+	now := time.Now()
+	attempts, ok := t.addresses[address]
+	if !ok {
+		attempts = &loginAttempts{}
+		t.addresses[address] = attempts
+	}
+
+	attempts.Failures += 1
+	attempts.LastFailure = now
+	t.failures = append(t.failures, now)
+
+	maxAttempts := int(_strconv.ParseInt(_os.GetEnv("LOGIN_MAX_ATTEMPTS"), 10, 64))
+	if maxAttempts > 0 && attempts.Failures >= maxAttempts {
+		attempts.BlockedTill = now.Add(lockoutDuration())
+		return
+	}
+
+	// Exponential back-off : delay * 2^(failures - 1), capped by the lockout window
+	delay := time.Duration(_strconv.ParseInt(_os.GetEnv("LOGIN_BACKOFF_DELAY"), 10, 64)) * time.Second
+	backoff := time.Duration(float64(delay) * math.Pow(2, float64(attempts.Failures-1)))
+	if backoff > lockoutDuration() {
+		backoff = lockoutDuration()
+	}
+	attempts.BlockedTill = now.Add(backoff)
+}
+
+// Clear the failed attempts recorded for the given address
+func (t *LoginThrottle) Succeed(address string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.addresses, address)
+}
+
+// Determine whether the session is exempt from login throttling
+// Agents proving their identity with a certificate signed by AGENT_CA_FILE can't be locked out by other clients' failures
+func isThrottlingExempt(session _session.GenericSession) bool {
+	return peerCertificate(session) != nil
+}
+
+// Retrieve the remote address associated with the session
+// On agent nodes, the initiator's id is used, since all clients come through the Master connection
+func sessionAddress(session _session.GenericSession) string {
+	session = unwrapSession(session)
+
+	if s, ok := session.(*melody.Session); ok {
+		return requestAddress(s.Request)
+	}
+
+	if s, ok := session.(*apiSession); ok {
+		return requestAddress(s.Request)
+	}
+
+	if initiator, exists := session.Get("initiator"); exists {
+		return initiator.(string)
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Failures spread across many addresses delay every attempt, without locking anyone out for longer than the cap
+func TestGlobalBackoff(t *testing.T) {
+	t.Setenv("LOGIN_THROTTLING_ENABLED", "TRUE")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "5")
+	t.Setenv("LOGIN_GLOBAL_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_DELAY", "2")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "300")
+
+	var throttle LoginThrottle
+	for i := 0; i < 2; i++ {
+		throttle.Fail(fmt.Sprintf("10.0.0.%d", i))
+	}
+	if wait := throttle.Wait("192.168.1.1"); wait != 0 {
+		t.Fatalf("Expected no global delay below the threshold, got %s", wait)
+	}
+
+	throttle.Fail("10.0.0.2")
+	if wait := throttle.Wait("192.168.1.1"); wait <= 0 || wait > 2*time.Second {
+		t.Fatalf("Expected a global delay of up to 2s at the threshold, got %s", wait)
+	}
+
+	for i := 3; i < 40; i++ {
+		throttle.Fail(fmt.Sprintf("10.0.0.%d", i))
+	}
+	if wait := throttle.Wait("192.168.1.1"); wait <= 2*time.Second || wait > globalBackoffCap {
+		t.Fatalf("Expected a global delay growing up to %s, got %s", globalBackoffCap, wait)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	_os "will-moss/isaiah/server/_internal/os"
+	_strconv "will-moss/isaiah/server/_internal/strconv"
+	"will-moss/isaiah/server/_internal/token"
+
+	"github.com/google/uuid"
+)
+
+// Name of the file where revoked tokens are stored, to keep them revoked across restarts
+const revokedTokensFile = "revoked_tokens"
+
+var ErrRevoked = errors.New("The token was revoked")
+
+// Represent the session tokens' state (signing key, and revoked tokens)
+type SessionTokens struct {
+	mutex   sync.Mutex
+	key     []byte
+	revoked map[string]int64 // Token ID -> Expiration timestamp
+}
+
+// Lazily load the signing key and the revoked tokens (must be called with the mutex held)
+func (t *SessionTokens) load() {
+	if t.key != nil {
+		return
+	}
+
+	if _os.GetEnv("AUTHENTICATION_TOKEN_KEY") != "" {
+		t.key = []byte(_os.GetEnv("AUTHENTICATION_TOKEN_KEY"))
+	} else {
+		// Warned about at startup
+		t.key = make([]byte, 32)
+		rand.Read(t.key)
+	}
+
+	t.revoked = make(map[string]int64)
+
+	raw, err := os.ReadFile(revokedTokensFile)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, line := range strings.Split(string(raw), "\n") {
+		parts := strings.Split(line, " ")
+		if len(parts) != 2 {
+			continue
+		}
+
+		expires := _strconv.ParseInt(parts[1], 10, 64)
+		if expires > now {
+			t.revoked[parts[0]] = expires
+		}
+	}
+}
+
+// Create a new signed token for the given account and role
+func (t *SessionTokens) Issue(user string, role string) (string, token.Claims) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	lifetime := time.Duration(_strconv.ParseInt(_os.GetEnv("AUTHENTICATION_TOKEN_LIFETIME"), 10, 64)) * time.Second
+	claims := token.Claims{
+		ID:      uuid.NewString(),
+		User:    user,
+		Role:    role,
+		Expires: time.Now().Add(lifetime).Unix(),
+	}
+
+	return token.Sign(claims, t.key), claims
+}
+
+// Verify the given token (signature, expiration, revocation) and retrieve its claims
+func (t *SessionTokens) Verify(raw string) (token.Claims, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	claims, err := token.Parse(raw, t.key)
+	if err != nil {
+		return claims, err
+	}
+
+	if _, revoked := t.revoked[claims.ID]; revoked {
+		return claims, ErrRevoked
+	}
+
+	return claims, nil
+}
+
+// Revoke the token with the given ID, and persist the list of revoked tokens
+func (t *SessionTokens) Revoke(id string, expires int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.load()
+
+	t.revoked[id] = expires
+
+	var content strings.Builder
+	now := time.Now().Unix()
+	for k, v := range t.revoked {
+		if v <= now {
+			delete(t.revoked, k)
+			continue
+		}
+		content.WriteString(fmt.Sprintf("%s %d\n", k, v))
+	}
+
+	if err := _os.WriteFileAtomically(revokedTokensFile, []byte(content.String()), 0600); err != nil {
+		log.Printf("Error persisting revoked session tokens -> %s", err)
+	}
+}
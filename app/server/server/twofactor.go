@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"will-moss/isaiah/server/_internal/totp"
+)
+
+// Number of recovery codes generated at enrollment
+const recoveryCodesCount = 10
+
+// Error returned when a recovery code doesn't belong to the account (or was used already)
+var errInvalidRecoveryCode = errors.New("The recovery code is invalid")
+
+// Represent the two-factor authentication state (last code used per account, to refuse replays)
+type TwoFactor struct {
+	mutex        sync.Mutex
+	lastCounters map[string]int64 // Account name -> Time-step counter of the last accepted code
+}
+
+// Represent an enrollment that was started, but not confirmed yet by the user
+type pendingEnrollment struct {
+	Secret        string
+	RecoveryCodes []string // Raw codes, hashed only once the enrollment is confirmed
+}
+
+// Record the use of the code matching the given counter, and refuse it if it was already used
+func (t *TwoFactor) accept(user string, counter int64) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.lastCounters == nil {
+		t.lastCounters = make(map[string]int64)
+	}
+
+	if last, exists := t.lastCounters[user]; exists && counter <= last {
+		return false
+	}
+
+	t.lastCounters[user] = counter
+	return true
+}
+
+// Generate a new set of single-use recovery codes (format : xxxxx-xxxxx)
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+
+		code := hex.EncodeToString(raw)
+		codes = append(codes, fmt.Sprintf("%s-%s", code[:5], code[5:]))
+	}
+
+	return codes, nil
+}
+
+// Normalize a recovery code as typed by the user, and compute its digest
+func hashRecoveryCode(code string) string {
+	return digest(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", "")))
+}
+
+// Verify the given TOTP code, or recovery code, for the given account
+// A valid recovery code is consumed, and the account is persisted without it
+func (server *Server) verifySecondFactor(user User, code string) bool {
+	if counter, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		return server.TwoFactor.accept(user.Name, counter)
+	}
+
+	// Check and consume the code on the account's latest version, so that each code is used once only
+	hashed := hashRecoveryCode(code)
+	remaining := 0
+	err := server.UpdateUser(user.Name, func(u *User) error {
+		index := slices.Index(u.RecoveryCodes, hashed)
+		if index == -1 {
+			return errInvalidRecoveryCode
+		}
+
+		u.RecoveryCodes = slices.Delete(u.RecoveryCodes, index, index+1)
+		remaining = len(u.RecoveryCodes)
+		return nil
+	})
+	if err != nil {
+		if err != errInvalidRecoveryCode {
+			log.Printf("Error consuming a recovery code for account %q -> %s", user.Name, err)
+		}
+		return false
+	}
+
+	log.Printf("Recovery code used for account %q (%d remaining)", user.Name, remaining)
+	return true
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"sync"
+	"testing"
+)
+
+// A recovery code submitted concurrently is accepted once only, and the other codes are kept
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	server := newTestServer()
+	server.Users = UsersArray{{
+		Name:          "alice",
+		Role:          RoleAdmin,
+		Secret:        "secret",
+		TOTPSecret:    "JBSWY3DPEHPK3PXP",
+		RecoveryCodes: []string{hashRecoveryCode("first"), hashRecoveryCode("second")},
+	}}
+	user, _ := server.FindUser("alice")
+
+	var wg sync.WaitGroup
+	accepted := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accepted <- server.verifySecondFactor(user, "first")
+		}()
+	}
+	wg.Wait()
+	close(accepted)
+
+	count := 0
+	for a := range accepted {
+		if a {
+			count++
+		}
+	}
+
+	if stored, _ := server.FindUser("alice"); count != 1 || len(stored.RecoveryCodes) != 1 {
+		t.Errorf("Expected the recovery code to be accepted once, got %d (%d codes left)", count, len(stored.RecoveryCodes))
+	}
+}
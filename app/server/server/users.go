@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	_os "will-moss/isaiah/server/_internal/os"
+	_session "will-moss/isaiah/server/_internal/session"
+)
+
+// Available roles, from the least to the most privileged
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Represent an ordered list of roles, used to compare privileges
+var rolesHierarchy = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Represent the minimum role required to run client-side commands, as found in menus
+var localCommandsRoles = map[string]string{
+	"hub":         RoleViewer,
+	"pull":        RoleOperator,
+	"rename":      RoleOperator,
+	"run_restart": RoleOperator,
+	"createStack": RoleAdmin,
+}
+
+// Represent the minimum role required to run the REST API's own actions, mirroring their websocket counterparts
+var apiActionsRoles = map[string]string{
+	"container.unpause": RoleOperator,
+	"container.remove":  RoleAdmin,
+	"image.remove":      RoleAdmin,
+	"volume.remove":     RoleAdmin,
+	"network.remove":    RoleAdmin,
+	"stack.unpause":     RoleOperator,
+}
+
+// Prevent concurrent updates of the users.json file
+var usersMutex sync.Mutex
+
+// Represent an Isaiah user account
+type User struct {
+	Name          string
+	Role          string
+	Secret        string   `json:",omitempty"` // Raw password
+	Hash          string   `json:",omitempty"` // Hashed password (used in place of Secret)
+	TOTPSecret    string   `json:",omitempty"` // Base32-encoded secret, when two-factor authentication is enrolled
+	RecoveryCodes []string `json:",omitempty"` // Hashed single-use codes, usable in place of a TOTP code
+}
+
+// Represent an array of Isaiah user accounts
+type UsersArray []User
+
+// Read and validate the user accounts stored in the given file (JSON array)
+func LoadUsers(path string) (UsersArray, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var users UsersArray
+	if err := json.Unmarshal(raw, &users); err != nil {
+		return nil, fmt.Errorf("%s file isn't properly formatted -> %s", path, err)
+	}
+
+	names := make([]string, 0)
+	for _, u := range users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("%s file contains an account without a name", path)
+		}
+		if slices.Contains(names, u.Name) {
+			return nil, fmt.Errorf("%s file contains the account %s more than once", path, u.Name)
+		}
+		if !slices.Contains(rolesHierarchy, u.Role) {
+			return nil, fmt.Errorf("%s file contains an invalid role for %s -> %s", path, u.Name, u.Role)
+		}
+		if u.Secret == "" && u.Hash == "" {
+			return nil, fmt.Errorf("%s file contains an account without password for %s", path, u.Name)
+		}
+		names = append(names, u.Name)
+	}
+
+	return users, nil
+}
+
+// Write the given user accounts to the given file, atomically
+func SaveUsers(path string, users UsersArray) error {
+	raw, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return _os.WriteFileAtomically(path, raw, 0600)
+}
+
+// Apply the given update to the stored account with the given name, and persist all accounts
+// The update runs on the account's latest version, and nothing is persisted when it fails
+func (server *Server) UpdateUser(name string, update func(user *User) error) error {
+	usersMutex.Lock()
+	defer usersMutex.Unlock()
+
+	users := slices.Clone(server.Users)
+
+	index := slices.IndexFunc(users, func(u User) bool { return u.Name == name })
+	if index == -1 {
+		return fmt.Errorf("The account %s doesn't exist", name)
+	}
+
+	user := users[index]
+	user.RecoveryCodes = slices.Clone(user.RecoveryCodes)
+	if err := update(&user); err != nil {
+		return err
+	}
+	users[index] = user
+
+	if err := SaveUsers("users.json", users); err != nil {
+		return err
+	}
+
+	server.Users = users
+	return nil
+}
+
+// Retrieve the latest version of the user account associated with the given name
+func (server *Server) FindUser(name string) (User, bool) {
+	usersMutex.Lock()
+	defer usersMutex.Unlock()
+
+	return server.Users.Find(name)
+}
+
+// Retrieve the user account associated with the given name
+func (users UsersArray) Find(name string) (User, bool) {
+	for _, u := range users {
+		if u.Name == name {
+			return u, true
+		}
+	}
+
+	return User{}, false
+}
+
+// Determine the minimum role required to run the given action
+func RequiredRole(action string) string {
+	// REST API calls forwarded to agents require the same role as their websocket counterparts
+	action = strings.TrimPrefix(action, "api.")
+
+	// Revealing redacted values requires the role configured for it (admin by default)
+	if isRevealing(action) {
+		if role := _os.GetEnv("REDACTION_REVEAL_ROLE"); slices.Contains(rolesHierarchy, role) {
+			return role
+		}
+		return RoleAdmin
+	}
+
+	if definition, exists := FindCommand(action); exists {
+		return definition.Role
+	}
+
+	if role, ok := localCommandsRoles[action]; ok {
+		return role
+	}
+
+	if role, ok := apiActionsRoles[action]; ok {
+		return role
+	}
+
+	// Unknown actions require the highest role
+	return RoleAdmin
+}
+
+// Determine whether the given role is at least as privileged as the required one
+func RoleSatisfies(role string, required string) bool {
+	current := slices.Index(rolesHierarchy, role)
+	if current == -1 {
+		return false
+	}
+
+	return current >= slices.Index(rolesHierarchy, required)
+}
+
+// Determine whether the session's user is allowed to run the given action
+func (server *Server) IsAllowed(session _session.GenericSession, action string) bool {
+	// Authentication commands are available to everyone, except the ones explicitly restricted
+	if strings.HasPrefix(action, "auth") && RequiredRole(action) == RoleViewer {
+		return true
+	}
+
+	role, exists := session.Get("role")
+	if !exists {
+		return false
+	}
+
+	return RoleSatisfies(role.(string), RequiredRole(action))
+}
@@ -21,11 +21,13 @@ import (
 type Volumes struct{}
 
 func (Volumes) RunCommand(server *Server, session _session.GenericSession, command ui.Command) {
+	docker := server.ClientFor(command)
+
 	switch command.Action {
 
 	// Single - Default menu
 	case "volume.menu":
-		actions := resources.VolumeSingleActions()
+		actions := server.allowedActions(session, resources.VolumeSingleActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Single - Remove menu
@@ -33,18 +35,18 @@ func (Volumes) RunCommand(server *Server, session _session.GenericSession, comma
 		var volume resources.Volume
 		mapstructure.Decode(command.Args["Resource"], &volume)
 
-		actions := resources.VolumeRemoveActions(volume)
+		actions := server.allowedActions(session, resources.VolumeRemoveActions(volume))
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - Bulk menu
 	case "volumes.bulk":
-		actions := resources.VolumesBulkActions()
+		actions := server.allowedActions(session, resources.VolumesBulkActions())
 		server.SendNotification(session, ui.NotificationData(ui.NP{Content: ui.JSON{"Actions": actions}}))
 
 	// Bulk - List
 	case "volumes.list":
 		columns := strings.Split(_os.GetEnv("COLUMNS_VOLUMES"), ",")
-		volumes := resources.VolumesList(server.Docker)
+		volumes := resources.VolumesList(docker)
 
 		rows := volumes.ToRows(columns)
 
@@ -75,7 +77,7 @@ func (Volumes) RunCommand(server *Server, session _session.GenericSession, comma
 
 	// Bulk - Prune
 	case "volumes.prune":
-		err := resources.VolumesPrune(server.Docker)
+		err := resources.VolumesPrune(docker)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -92,7 +94,7 @@ func (Volumes) RunCommand(server *Server, session _session.GenericSession, comma
 		var volume resources.Volume
 		mapstructure.Decode(command.Args["Resource"], &volume)
 
-		err := volume.Remove(server.Docker, false)
+		err := volume.Remove(docker, false)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -110,7 +112,7 @@ func (Volumes) RunCommand(server *Server, session _session.GenericSession, comma
 		var volume resources.Volume
 		mapstructure.Decode(command.Args["Resource"], &volume)
 
-		err := volume.Remove(server.Docker, true)
+		err := volume.Remove(docker, true)
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
 			break
@@ -202,7 +204,7 @@ func (Volumes) RunCommand(server *Server, session _session.GenericSession, comma
 	case "volume.inspect.config":
 		var volume resources.Volume
 		mapstructure.Decode(command.Args["Resource"], &volume)
-		config, err := volume.GetConfig(server.Docker)
+		config, err := volume.GetConfig(docker)
 
 		if err != nil {
 			server.SendNotification(session, ui.NotificationError(ui.NP{Content: ui.JSON{"Message": err.Error()}}))
@@ -14,6 +14,7 @@ type Notification struct {
 	Content  map[string]interface{} // The content of the notification (JSON string)
 	Follow   string                 // The command the client should run when they receive the notification
 	Display  bool                   // Whether or not the notification should be shown to the end user
+	Sequence int32                  // The Sequence of the command that produced the notification (0 when spontaneous)
 }
 
 type NotificationParams struct {
@@ -8,6 +8,7 @@ type OverviewInstance struct {
 	Docker    OverviewDocker
 	Server    OverviewServer
 	Resources OverviewResources
+	Error     string `json:",omitempty"` // Set when the instance couldn't be queried (offline host, timeout)
 }
 
 type OverviewInstanceArray []OverviewInstance
@@ -22,8 +23,11 @@ type OverviewServer struct {
 }
 
 type OverviewDocker struct {
-	Version string
-	Host    string
+	Version         string
+	Host            string
+	OperatingSystem string
+	KernelVersion   string
+	StorageDriver   string
 }
 
 type OverviewResources struct {
@@ -31,4 +35,14 @@ type OverviewResources struct {
 	Images     JSON
 	Volumes    JSON
 	Networks   JSON
+	DiskUsage  *OverviewDiskUsage `json:",omitempty"` // Unset when the daemon didn't report it in time
+}
+
+// Space used on the daemon's disk, in bytes
+type OverviewDiskUsage struct {
+	Images     int64
+	Containers int64
+	Volumes    int64
+	BuildCache int64
+	Total      int64
 }